@@ -0,0 +1,255 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/elanticrypt0/pyxelart/pyxelart"
+)
+
+// convFlags reúne las opciones de conversión que comparten los subcomandos
+// file y dir
+type convFlags struct {
+	quality, crf, pixelate, colors, threads, retries, rotate int
+
+	lagInFrames, autoAltRef, arnrMaxFrames int
+
+	fps, scale, denoise, sharpen, loudness, sample, speed, fadeIn, fadeOut, watermarkOpacity float64
+
+	timeout time.Duration
+
+	ffmpegPath, ffprobePath, ffmpegArgs, configPath, jsonProgress string
+
+	resize, crop, codec, preset, audioCodec, audioBitrate string
+
+	verbose, quiet, twoPass, dryRun, jsonOutput, noAudio, stripMetadata, progress bool
+
+	keepName, overwrite, skipExisting, thumbnail, rowMT, boomerang, normalizeAudio, autorotate bool
+
+	deleteSource, assumeYes, verify, removeInvalid, alpha, twoOutput, noUpscale, loopAudio, autoDeinterlace, pad, grayscale, tonemap bool
+
+	thumbnailTime, thumbnailFormat, outputFormat, hwAccel, startTime, endTime, customFilters, subtitles, watermark, watermarkPos, deinterlace, padColor, duotone, dither, scaleAlgo string
+
+	outputTemplate, bitrate, targetSize, minFree, tmpDir, maxRate, bufSize, keyInt, loopTo, maxDuration, minDuration string
+}
+
+// registerConversionFlags define en fs las opciones de conversión comunes
+func registerConversionFlags(fs *flag.FlagSet) *convFlags {
+	f := &convFlags{}
+	fs.IntVar(&f.quality, "quality", 30, "Calidad del video (0-100)")
+	fs.IntVar(&f.crf, "crf", -1, "Calidad constante (reemplaza a -quality; VP9: 0-63, VP8: 4-63, AV1: 1-63, MP4: 0-51)")
+	fs.StringVar(&f.bitrate, "bitrate", "", "Bitrate de video fijo en kbps o con sufijo (ej: 1500, 1500k, 2M); reemplaza a -quality, no se combina con -crf")
+	fs.StringVar(&f.targetSize, "target-size", "", "Tamaño aproximado de cada salida (ej: 8MB, 500KB); calcula el bitrate y usa dos pasadas")
+	fs.StringVar(&f.maxRate, "maxrate", "", "Tope de bitrate de video para streaming (ej: 2M, 1500k)")
+	fs.StringVar(&f.bufSize, "bufsize", "", "Búfer del control de bitrate (por defecto, el doble de -maxrate)")
+	fs.StringVar(&f.outputFormat, "format", "webm", "Formato de salida (webm, mp4, gif; mp4 usa H.264 y AAC, gif no lleva audio)")
+	fs.StringVar(&f.preset, "preset", "balanced", "Velocidad de codificación (fast, balanced, slow)")
+	fs.StringVar(&f.codec, "codec", "vp9", "Códec de video para WebM (vp8, vp9, av1)")
+	fs.BoolVar(&f.alpha, "alpha", false, "Conservar la transparencia del original (solo vp9 en WebM)")
+	fs.StringVar(&f.hwAccel, "hwaccel", "", "Codificación por hardware para mp4 (vaapi, nvenc, qsv)")
+	fs.StringVar(&f.resize, "resize", "", "Redimensionar video (formato: widthxheight)")
+	fs.BoolVar(&f.pad, "pad", false, "Con -resize, completar con bandas hasta el tamaño exacto (todas las salidas miden lo mismo)")
+	fs.StringVar(&f.padColor, "pad-color", "black", "Color de las bandas de -pad (nombre o #RRGGBB)")
+	fs.BoolVar(&f.noUpscale, "no-upscale", true, "No agrandar con -resize los videos más chicos que el tamaño pedido (use -no-upscale=false para permitirlo)")
+	fs.StringVar(&f.scaleAlgo, "scale-algo", "", "Interpolación al escalar: bilinear, bicubic, lanczos, neighbor (neighbor para pixel art, lanczos para fotografía)")
+	fs.Float64Var(&f.scale, "scale", 0, "Escalar a un porcentaje del tamaño original (ej: 50; excluye a -resize)")
+	fs.StringVar(&f.crop, "crop", "", "Recortar video (formato: x:y:width:height)")
+	fs.StringVar(&f.startTime, "start", "", "Inicio del segmento a convertir (segundos o HH:MM:SS)")
+	fs.StringVar(&f.endTime, "end", "", "Fin del segmento a convertir (segundos o HH:MM:SS)")
+	fs.StringVar(&f.loopTo, "loop-to", "", "Repetir el video hasta esta duración en segundos o HH:MM:SS (ej: 60); si es más largo solo se corta")
+	fs.StringVar(&f.maxDuration, "max-duration", "", "Omitir los videos que duran más que esto, en segundos o HH:MM:SS (ej: 1:00:00)")
+	fs.StringVar(&f.minDuration, "min-duration", "", "Omitir los videos que duran menos que esto, en segundos o HH:MM:SS")
+	fs.BoolVar(&f.loopAudio, "loop-audio", true, "Con -loop-to, repetir también el audio (use -loop-audio=false para quitarlo)")
+	fs.Float64Var(&f.speed, "speed", 0, "Multiplicador de velocidad: 2 = el doble de rápido (timelapse), 0.5 = cámara lenta")
+	fs.Float64Var(&f.fadeIn, "fade-in", 0, "Segundos de fundido desde negro al comienzo (también del audio)")
+	fs.Float64Var(&f.fadeOut, "fade-out", 0, "Segundos de fundido a negro al final (también del audio)")
+	fs.Float64Var(&f.sample, "sample", 0, "Convertir solo los primeros N segundos para probar calidad y tamaño (salida con sufijo _sample)")
+	fs.BoolVar(&f.boomerang, "boomerang", false, "Repetir el clip al revés para un loop continuo (sin audio)")
+	fs.StringVar(&f.customFilters, "filters", "", "Filtergraph propio que se agrega a los filtros generados (ej: \"eq=saturation=1.5\")")
+	fs.StringVar(&f.deinterlace, "deinterlace", "", "Desentrelazar con yadif: frame (mantiene los fps) o field (duplica los fps)")
+	fs.BoolVar(&f.autoDeinterlace, "auto-deinterlace", false, "Desentrelazar (modo frame) solo los videos que ffprobe informa como entrelazados")
+	fs.Float64Var(&f.denoise, "denoise", 0, "Reducir ruido antes de escalar (0 = desactivado, 4 = moderado, máx. 20)")
+	fs.StringVar(&f.subtitles, "subtitles", "", "Incrustar subtítulos: un archivo .srt/.ass/.ssa/.vtt o embedded:N para la pista N del original")
+	fs.StringVar(&f.watermark, "watermark", "", "Imagen a superponer como marca de agua (ej: logo.png)")
+	fs.StringVar(&f.watermarkPos, "watermark-pos", "", "Posición de la marca de agua: topleft, top, topright, left, center, right, bottomleft, bottom o bottomright (por defecto: bottomright)")
+	fs.Float64Var(&f.watermarkOpacity, "watermark-opacity", 1, "Opacidad de la marca de agua, entre 0 y 1")
+	fs.Float64Var(&f.sharpen, "sharpen", 0, "Enfocar después de escalar (0 = desactivado, 1 = moderado, máx. 5)")
+	fs.IntVar(&f.rotate, "rotate", 0, "Girar el video en sentido horario (90, 180, 270)")
+	fs.BoolVar(&f.autorotate, "autorotate", false, "Corregir el giro según los metadatos de rotación del original")
+	fs.IntVar(&f.pixelate, "pixelate", 0, "Efecto pixel art: tamaño del bloque en píxeles (0 = desactivado)")
+	fs.BoolVar(&f.tonemap, "tonemap", false, "Convertir los originales HDR a SDR para que no se vean lavados (requiere ffmpeg con zscale)")
+	fs.BoolVar(&f.grayscale, "grayscale", false, "Convertir a blanco y negro (se combina con -pixelate y -colors)")
+	fs.StringVar(&f.duotone, "duotone", "", "Duotono: color de las sombras y de las luces (ej: #1b1b3a,#f2d479)")
+	fs.IntVar(&f.colors, "colors", 0, "Reducir la paleta a N colores (2-256, 0 = desactivado)")
+	fs.StringVar(&f.dither, "dither", "", "Tramado al reducir colores: none, bayer, floyd_steinberg, sierra2 (requiere -colors o gif)")
+	fs.Float64Var(&f.fps, "fps", 0, "Cuadros por segundo de salida (0 = sin cambios; la duración se mantiene)")
+	fs.StringVar(&f.keyInt, "keyint", "", "Cuadros entre keyframes o auto (2 segundos): más keyframes, saltos más precisos pero archivos más grandes")
+	fs.StringVar(&f.audioCodec, "audio-codec", "opus", "Códec de audio para WebM (opus, vorbis)")
+	fs.StringVar(&f.audioBitrate, "audio-bitrate", "96k", "Bitrate de audio (ej: 96k, 128k)")
+	fs.BoolVar(&f.normalizeAudio, "normalize-audio", false, "Nivelar el volumen del audio (loudnorm)")
+	fs.Float64Var(&f.loudness, "loudness", -16, "Sonoridad objetivo en LUFS para -normalize-audio (ej: -14, -23)")
+	fs.BoolVar(&f.noAudio, "no-audio", false, "Eliminar la pista de audio")
+	fs.BoolVar(&f.stripMetadata, "strip-metadata", false, "No copiar los metadatos del video original")
+	fs.IntVar(&f.retries, "retries", 0, "Reintentos si ffmpeg falla (espera creciente entre intentos)")
+	fs.StringVar(&f.minFree, "min-free", "", "Espacio que debe quedar libre en el disco de salida además del tamaño estimado (ej: 1GB); si no alcanza, el archivo se omite")
+	fs.StringVar(&f.tmpDir, "tmp-dir", "", "Directorio donde ffmpeg escribe cada salida antes de moverla a su destino (vacío = junto a la salida)")
+	fs.DurationVar(&f.timeout, "timeout", 0, "Tiempo máximo por archivo (ej: 90s, 10m; 0 = sin límite)")
+	fs.BoolVar(&f.twoPass, "two-pass", false, "Codificar en dos pasadas (mejor calidad para un mismo tamaño)")
+	fs.IntVar(&f.threads, "threads", 0, "Hilos de ffmpeg por conversión (0 = automático según los núcleos)")
+	fs.BoolVar(&f.rowMT, "row-mt", true, "Multihilo por filas en VP9 (use -row-mt=false para desactivarlo)")
+	fs.IntVar(&f.lagInFrames, "lag-in-frames", -1, "Avanzado VP9: cuadros que el encoder analiza por adelantado, 0-25 (-1 = por defecto)")
+	fs.IntVar(&f.autoAltRef, "auto-alt-ref", -1, "Avanzado VP9: cuadros de referencia alternativos, 0-6 (-1 = por defecto)")
+	fs.IntVar(&f.arnrMaxFrames, "arnr-maxframes", -1, "Avanzado VP9: cuadros del filtro de ruido temporal, 0-15 (-1 = por defecto)")
+	fs.BoolVar(&f.keepName, "keep-name", false, "Conservar el nombre original del archivo (solo cambia la extensión)")
+	fs.StringVar(&f.outputTemplate, "output-template", "", "Nombre de salida con marcadores {name}, {width}, {height}, {quality}, {codec}, {date} (ej: \"{name}_{width}x{height}_q{quality}\")")
+	fs.BoolVar(&f.overwrite, "overwrite", false, "Reconvertir aunque la salida ya exista y esté actualizada")
+	fs.BoolVar(&f.skipExisting, "skip-existing", false, "Omitir si la salida ya existe, sin comparar fechas")
+	fs.BoolVar(&f.deleteSource, "delete-source", false, "Eliminar el original después de una conversión verificada (pide confirmación)")
+	fs.BoolVar(&f.assumeYes, "yes", false, "No pedir confirmación (para -delete-source)")
+	fs.BoolVar(&f.verify, "verify", false, "Comprobar con ffprobe que la salida tenga video y la duración esperada")
+	fs.BoolVar(&f.removeInvalid, "remove-invalid", false, "Con -verify, eliminar la salida que no pasa la verificación")
+	fs.BoolVar(&f.thumbnail, "thumbnail", false, "Generar una imagen de vista previa junto a cada video")
+	fs.StringVar(&f.thumbnailTime, "thumbnail-time", "10%", "Momento de la miniatura en segundos o porcentaje de la duración")
+	fs.StringVar(&f.thumbnailFormat, "thumbnail-format", "jpg", "Formato de la miniatura (jpg, png, webp)")
+	fs.BoolVar(&f.twoOutput, "two-output", false, "Generar video y miniatura en una sola ejecución de ffmpeg (con -thumbnail)")
+	fs.BoolVar(&f.dryRun, "dry-run", false, "Mostrar los comandos de ffmpeg sin ejecutarlos")
+	fs.StringVar(&f.jsonProgress, "json-progress", "", "Emitir el progreso como eventos JSON, uno por línea: stderr o la ruta de un archivo o named pipe")
+	fs.BoolVar(&f.progress, "progress", isTerminal(os.Stdout), "Mostrar barra de progreso (activada por defecto en una terminal)")
+	fs.StringVar(&f.ffmpegArgs, "ffmpeg-args", "", "Avanzado: argumentos extra para ffmpeg, sin validar, antes del archivo de salida (ej: \"-tune film\")")
+	fs.StringVar(&f.configPath, "config", "", "Archivo de configuración con valores por defecto (por defecto ~/.pyxelart.yaml o ~/.pyxelart.json)")
+	fs.StringVar(&f.ffmpegPath, "ffmpeg-path", envOrDefault("FFMPEG_BIN", "ffmpeg"), "Ruta o nombre del binario de ffmpeg (env: FFMPEG_BIN)")
+	fs.StringVar(&f.ffprobePath, "ffprobe-path", envOrDefault("FFPROBE_BIN", "ffprobe"), "Ruta o nombre del binario de ffprobe (env: FFPROBE_BIN)")
+	fs.BoolVar(&f.jsonOutput, "json", false, "Emitir los resultados en formato JSON")
+	fs.BoolVar(&f.quiet, "quiet", false, "Mostrar solo los errores")
+	fs.BoolVar(&f.verbose, "verbose", false, "Mostrar información detallada")
+	fs.BoolVar(&f.verbose, "v", false, "Mostrar información detallada (forma corta)")
+	return f
+}
+
+// options arma las opciones de la biblioteca a partir de los valores leídos
+func (f *convFlags) options() (pyxelart.ConversionOptions, error) {
+	extraArgs, err := splitArgs(f.ffmpegArgs)
+	if err != nil {
+		return pyxelart.ConversionOptions{}, fmt.Errorf("-ffmpeg-args: %w", err)
+	}
+	targetSizeBytes, err := parseSize(f.targetSize)
+	if err != nil {
+		return pyxelart.ConversionOptions{}, fmt.Errorf("-target-size: %w", err)
+	}
+	minFreeBytes, err := parseSize(f.minFree)
+	if err != nil {
+		return pyxelart.ConversionOptions{}, fmt.Errorf("-min-free: %w", err)
+	}
+	if f.tmpDir != "" {
+		if info, err := os.Stat(f.tmpDir); err != nil || !info.IsDir() {
+			return pyxelart.ConversionOptions{}, fmt.Errorf("-tmp-dir '%s' no es un directorio existente", f.tmpDir)
+		}
+	}
+
+	return pyxelart.ConversionOptions{
+		Quality:    f.quality,
+		CRF:        f.crf,
+		Bitrate:    f.bitrate,
+		TargetSize: targetSizeBytes,
+		MaxRate:    f.maxRate,
+		BufSize:    f.bufSize,
+		Codec:      f.codec,
+		Alpha:      f.alpha,
+		Preset:     f.preset,
+		Resize:     f.resize,
+		NoUpscale:  f.noUpscale,
+		Pad:        f.pad,
+		PadColor:   f.padColor,
+		Scale:      f.scale,
+		ScaleAlgo:  f.scaleAlgo,
+		Crop:       f.crop,
+		Rotate:     f.rotate,
+		FPS:        f.fps,
+		KeyInt:     f.keyInt,
+
+		Autorotate: f.autorotate,
+
+		Filters: f.customFilters,
+
+		Deinterlace:     f.deinterlace,
+		AutoDeinterlace: f.autoDeinterlace,
+
+		Denoise: f.denoise,
+		Sharpen: f.sharpen,
+
+		Subtitles: f.subtitles,
+
+		Watermark:        f.watermark,
+		WatermarkPos:     f.watermarkPos,
+		WatermarkOpacity: f.watermarkOpacity,
+
+		StartTime: f.startTime,
+		EndTime:   f.endTime,
+		Sample:    f.sample,
+		Speed:     f.speed,
+		FadeIn:    f.fadeIn,
+		FadeOut:   f.fadeOut,
+
+		LoopTo:    f.loopTo,
+		LoopAudio: f.loopAudio,
+
+		MaxDuration: f.maxDuration,
+		MinDuration: f.minDuration,
+
+		OutputFormat: f.outputFormat,
+		HWAccel:      f.hwAccel,
+
+		Boomerang:      f.boomerang,
+		PixelateFactor: f.pixelate,
+		PaletteColors:  f.colors,
+		Dither:         f.dither,
+
+		Tonemap:   f.tonemap,
+		Grayscale: f.grayscale,
+		Duotone:   f.duotone,
+
+		AudioCodec:   f.audioCodec,
+		AudioBitrate: f.audioBitrate,
+		NoAudio:      f.noAudio,
+
+		NormalizeAudio: f.normalizeAudio,
+		LoudnessTarget: f.loudness,
+
+		StripMetadata: f.stripMetadata,
+
+		OutputTemplate: f.outputTemplate,
+
+		KeepName:     f.keepName,
+		Overwrite:    f.overwrite,
+		SkipExisting: f.skipExisting,
+		DeleteSource: f.deleteSource,
+
+		Verify:        f.verify,
+		RemoveInvalid: f.removeInvalid,
+
+		Thumbnail:       f.thumbnail,
+		ThumbnailTime:   f.thumbnailTime,
+		ThumbnailFormat: f.thumbnailFormat,
+		TwoOutput:       f.twoOutput,
+
+		ExtraArgs: extraArgs,
+
+		LagInFrames:   f.lagInFrames,
+		AutoAltRef:    f.autoAltRef,
+		ArnrMaxFrames: f.arnrMaxFrames,
+
+		Threads:  f.threads,
+		RowMT:    f.rowMT,
+		Timeout:  f.timeout,
+		MinFree:  minFreeBytes,
+		TmpDir:   f.tmpDir,
+		Retries:  f.retries,
+		TwoPass:  f.twoPass,
+		DryRun:   f.dryRun,
+		Progress: f.progress && !f.jsonOutput && !f.quiet,
+		JSON:     f.jsonOutput,
+		Verbose:  f.verbose,
+	}, nil
+}
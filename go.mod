@@ -0,0 +1,3 @@
+module github.com/elanticrypt0/pyxelart
+
+go 1.22
@@ -0,0 +1,874 @@
+package pyxelart
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// alternativeOutputPath busca un nombre libre para una salida que ya usa otro
+// video del lote. Con -flatten primero prueba agregando el nombre de la carpeta
+// de origen; después recurre a un contador (clip_2.webm, clip_3.webm, ...)
+func alternativeOutputPath(outputFile, relPath string, flatten bool, used map[string]string) string {
+	dir := filepath.Dir(outputFile)
+	ext := filepath.Ext(outputFile)
+	stem := strings.TrimSuffix(filepath.Base(outputFile), ext)
+
+	if flatten {
+		if parent := filepath.Base(filepath.Dir(relPath)); parent != "." {
+			candidate := filepath.Join(dir, stem+"_"+snakeCaseFilename(parent)+ext)
+			if _, taken := used[candidate]; !taken {
+				return candidate
+			}
+		}
+	}
+	for n := 2; ; n++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s_%d%s", stem, n, ext))
+		if _, taken := used[candidate]; !taken {
+			return candidate
+		}
+	}
+}
+
+// planOutputs decide la salida de cada video antes de encolarlo. Las rutas
+// replican la ubicación relativa a inputDir; con inputDir vacío cada salida queda
+// junto a su original (o directamente en outputDir si se usa Flatten).
+// outputOwners registra el original de cada salida ya asignada, también la de
+// revisiones anteriores de -watch, y se completa con las nuevas
+func planOutputs(ctx context.Context, videos []string, inputDir, outputDir string, opts ConversionOptions, dirOpts DirectoryOptions, outputOwners map[string]string) ([]string, error) {
+	// Originales distintos pueden generar el mismo nombre ("My Video.mp4" y
+	// "my_video.mp4"), así que los choques se resuelven acá, siempre en el mismo
+	// orden, en lugar de que un trabajador pise en silencio la salida de otro
+	outputFiles := make([]string, len(videos))
+	for i, video := range videos {
+		relPath := video
+		if inputDir != "" {
+			var err error
+			if relPath, err = filepath.Rel(inputDir, video); err != nil {
+				relPath = filepath.Base(video)
+			}
+		}
+		// Las dimensiones de la plantilla requieren analizar cada original; si
+		// falla, el error aparece al convertirlo
+		var info *VideoInfo
+		if templateNeedsInfo(opts.OutputTemplate) {
+			info, _ = probeVideo(ctx, opts.run(), opts.ffprobe(), video)
+		}
+		name := outputFileName(video, opts, info)
+
+		outputFile := filepath.Join(outputDir, filepath.Dir(relPath), name)
+		if dirOpts.Flatten {
+			outputFile = filepath.Join(outputDir, name)
+		}
+		if owner, taken := outputOwners[outputFile]; taken {
+			if dirOpts.OnCollision == "error" {
+				return nil, fmt.Errorf("'%s' y '%s' generan la misma salida '%s'", owner, video, outputFile)
+			}
+			outputFile = alternativeOutputPath(outputFile, relPath, dirOpts.Flatten, outputOwners)
+		}
+		outputOwners[outputFile] = video
+		outputFiles[i] = outputFile
+	}
+	return outputFiles, nil
+}
+
+// defaultOutputDir es el directorio de salida cuando no se indica uno: un
+// subdirectorio de inputDir con el nombre del formato
+func defaultOutputDir(inputDir string, opts ConversionOptions) string {
+	return filepath.Join(inputDir, strings.TrimPrefix(outputExtension(opts), "."))
+}
+
+// sameDir indica si a y b son el mismo directorio
+func sameDir(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// findVideos busca en inputDir los videos que entran en el lote según las
+// extensiones, los patrones y los límites de tamaño. También devuelve cuántos
+// se descartaron por tamaño. outputDir no se recorre aunque esté dentro de
+// inputDir: sus archivos son resultados, no originales
+func findVideos(inputDir, outputDir string, dirOpts DirectoryOptions) ([]string, int, error) {
+	// Extensiones de video soportadas. Los .webm por defecto suelen ser resultados
+	// de corridas anteriores: recodificarlos solo agrega pérdida de calidad, así que
+	// se excluyen salvo que se pidan explícitamente
+	videoExtensions := make(map[string]bool)
+	if len(dirOpts.Extensions) > 0 {
+		for _, ext := range dirOpts.Extensions {
+			videoExtensions[normalizeExtension(ext)] = true
+		}
+	} else {
+		for _, ext := range defaultVideoExtensions {
+			if ext == ".webm" && dirOpts.SkipWebm {
+				continue
+			}
+			videoExtensions[ext] = true
+		}
+	}
+	for _, ext := range dirOpts.ExtraExtensions {
+		videoExtensions[normalizeExtension(ext)] = true
+	}
+
+	// Validar los patrones antes de recorrer el directorio
+	for _, pattern := range append(append([]string{}, dirOpts.Include...), dirOpts.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, 0, fmt.Errorf("patrón inválido '%s': %w", pattern, err)
+		}
+	}
+
+	// isCandidate decide si un archivo entra en el lote según su extensión y los
+	// patrones de inclusión/exclusión
+	isCandidate := func(path string) bool {
+		// Salidas a medio escribir (ver tempOutputPath)
+		if strings.HasSuffix(path, ".part") {
+			return false
+		}
+		if !videoExtensions[strings.ToLower(filepath.Ext(path))] {
+			return false
+		}
+		relPath, err := filepath.Rel(inputDir, path)
+		if err != nil {
+			relPath = filepath.Base(path)
+		}
+		if len(dirOpts.Include) > 0 && !matchesAny(dirOpts.Include, relPath) {
+			return false
+		}
+		return !matchesAny(dirOpts.Exclude, relPath)
+	}
+
+	// Encontrar todos los videos
+	var videos []string
+
+	if dirOpts.Recursive {
+		// Buscar en subdirectorios
+		err := filepath.Walk(inputDir, func(path string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && path != inputDir && outputDir != "" && sameDir(path, outputDir) {
+				return filepath.SkipDir
+			}
+			if !info.IsDir() && isCandidate(path) {
+				videos = append(videos, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, 0, fmt.Errorf("error al buscar videos: %w", err)
+		}
+	} else {
+		// Buscar solo en el directorio principal
+		entries, err := os.ReadDir(inputDir)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error al leer directorio: %w", err)
+		}
+
+		for _, entry := range entries {
+			path := filepath.Join(inputDir, entry.Name())
+			if !entry.IsDir() && isCandidate(path) {
+				videos = append(videos, path)
+			}
+		}
+	}
+
+	// Filtrar por tamaño antes de encolar
+	skippedBySize := 0
+	if dirOpts.MinSize > 0 || dirOpts.MaxSize > 0 {
+		filtered := videos[:0]
+		for _, video := range videos {
+			info, err := os.Stat(video)
+			if err != nil {
+				continue
+			}
+			if (dirOpts.MinSize > 0 && info.Size() < dirOpts.MinSize) ||
+				(dirOpts.MaxSize > 0 && info.Size() > dirOpts.MaxSize) {
+				skippedBySize++
+				continue
+			}
+			filtered = append(filtered, video)
+		}
+		videos = filtered
+	}
+
+	return videos, skippedBySize, nil
+}
+
+// ProcessDirectory procesa todos los videos en un directorio
+func ProcessDirectory(ctx context.Context, inputDir, outputDir string, opts ConversionOptions, dirOpts DirectoryOptions) (*ConversionStats, error) {
+	// Verificar directorio de entrada
+	if _, err := os.Stat(inputDir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("el directorio '%s' no existe", inputDir)
+	}
+
+	// Determinar directorio de salida
+	if outputDir == "" {
+		outputDir = defaultOutputDir(inputDir, opts)
+	}
+
+	// Crear directorio de salida si no existe
+	if !opts.DryRun {
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return nil, fmt.Errorf("error al crear directorio de salida: %w", err)
+		}
+	}
+
+	videos, skippedBySize, err := findVideos(inputDir, outputDir, dirOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(videos) == 0 {
+		if !opts.JSON {
+			Infof("No se encontraron videos en '%s'\n", inputDir)
+		}
+		if !dirOpts.Watch {
+			return &ConversionStats{SkippedBySize: skippedBySize}, nil
+		}
+	} else if !opts.JSON {
+		Infof("Encontrados %d videos para procesar\n", len(videos))
+	}
+
+	stats := &ConversionStats{SkippedBySize: skippedBySize}
+
+	// Con -watch no se toman como nuevos ni los originales ya vistos ni las
+	// salidas generadas (pueden quedar en inputDir si coincide con outputDir)
+	known := videos
+	outputOwners := make(map[string]string)
+	if len(videos) > 0 {
+		outputFiles, err := planOutputs(ctx, videos, inputDir, outputDir, opts, dirOpts, outputOwners)
+		if err != nil {
+			return nil, err
+		}
+		known = append(slices.Clone(videos), outputFiles...)
+		queued, queuedOutputs, err := selectWork(videos, outputFiles, opts, dirOpts)
+		if err != nil {
+			return nil, err
+		}
+		stats.Total = len(queued)
+		if err := runWorkers(ctx, queued, queuedOutputs, opts, dirOpts, stats); err != nil {
+			return nil, err
+		}
+	}
+
+	if dirOpts.Watch && !stats.Aborted {
+		if err := watchDirectory(ctx, inputDir, outputDir, opts, dirOpts, stats, known, outputOwners); err != nil {
+			return nil, err
+		}
+	}
+	printBatchSummary(ctx, stats, opts)
+
+	return stats, nil
+}
+
+// watchDirectory sigue revisando inputDir cada dirOpts.WatchInterval y convierte
+// los videos que aparecen, hasta una interrupción. Un archivo nuevo se procesa
+// recién cuando su tamaño no cambió entre dos revisiones, para no tomar copias a
+// medio terminar. known son los videos y las salidas de la primera pasada, y
+// outputOwners las salidas ya asignadas, para resolver los choques de nombre con
+// los videos nuevos igual que dentro de un mismo lote
+func watchDirectory(ctx context.Context, inputDir, outputDir string, opts ConversionOptions, dirOpts DirectoryOptions, stats *ConversionStats, known []string, outputOwners map[string]string) error {
+	seen := make(map[string]bool, len(known))
+	for _, video := range known {
+		seen[video] = true
+	}
+	growing := make(map[string]int64) // Tamaño de cada archivo nuevo en la revisión anterior
+
+	interval := dirOpts.WatchInterval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	if !opts.JSON {
+		Infof("Esperando videos nuevos en '%s' (Ctrl-C para terminar)\n", inputDir)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-dirOpts.Drain:
+			return nil
+		case <-ticker.C:
+		}
+
+		videos, _, err := findVideos(inputDir, outputDir, dirOpts)
+		if err != nil {
+			errorf("Error: %s\n", err)
+			continue
+		}
+		var ready []string
+		for _, video := range videos {
+			if seen[video] {
+				continue
+			}
+			info, err := os.Stat(video)
+			if err != nil {
+				continue
+			}
+			if size, ok := growing[video]; ok && size == info.Size() {
+				ready = append(ready, video)
+				seen[video] = true
+				delete(growing, video)
+			} else {
+				growing[video] = info.Size()
+			}
+		}
+		if len(ready) == 0 {
+			continue
+		}
+
+		outputFiles, err := planOutputs(ctx, ready, inputDir, outputDir, opts, dirOpts, outputOwners)
+		if err == nil {
+			ready, outputFiles, err = selectWork(ready, outputFiles, opts, dirOpts)
+		}
+		if err != nil {
+			errorf("Error: %s\n", err)
+			continue
+		}
+		stats.Total += len(ready)
+		for _, output := range outputFiles {
+			seen[output] = true
+		}
+		if err := runWorkers(ctx, ready, outputFiles, opts, dirOpts, stats); err != nil {
+			return err
+		}
+		if stats.Aborted {
+			return nil
+		}
+	}
+}
+
+// ProcessList convierte los videos listados en un archivo de manifiesto, uno por
+// línea ("-" lee la lista de la entrada estándar). Las líneas vacías y las que
+// empiezan con # se ignoran. Una ruta inválida se registra como error y el lote
+// sigue. Sin outputDir cada salida queda junto a su original
+func ProcessList(ctx context.Context, listPath, outputDir string, opts ConversionOptions, dirOpts DirectoryOptions) (*ConversionStats, error) {
+	var reader io.Reader = os.Stdin
+	if listPath != "-" {
+		file, err := os.Open(listPath)
+		if err != nil {
+			return nil, fmt.Errorf("error al abrir la lista: %w", err)
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	stats := &ConversionStats{}
+	var videos []string
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(reader)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		path := strings.TrimSpace(scanner.Text())
+		if path == "" || strings.HasPrefix(path, "#") || seen[filepath.Clean(path)] {
+			continue
+		}
+		seen[filepath.Clean(path)] = true
+
+		var problem string
+		if info, err := os.Stat(path); os.IsNotExist(err) {
+			problem = "el archivo no existe"
+		} else if err != nil {
+			problem = err.Error()
+		} else if info.IsDir() {
+			problem = "es un directorio"
+		}
+		if problem != "" {
+			if !opts.JSON {
+				errorf("Error en la línea %d (%s): %s\n", lineNum, path, problem)
+			}
+			stats.Total++
+			stats.agregarResultado(ConversionResult{
+				InputPath: path,
+				Error:     fmt.Sprintf("línea %d: %s", lineNum, problem),
+			})
+			continue
+		}
+		videos = append(videos, path)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error al leer la lista: %w", err)
+	}
+
+	if len(videos) == 0 {
+		if !opts.JSON {
+			Infof("La lista no contiene videos para procesar\n")
+		}
+		return stats, nil
+	}
+	if !opts.JSON {
+		Infof("Encontrados %d videos para procesar\n", len(videos))
+	}
+
+	// Las rutas de la lista no comparten un directorio base: con -output todas
+	// las salidas van directamente a ese directorio
+	if outputDir != "" {
+		dirOpts.Flatten = true
+	}
+	outputFiles, err := planOutputs(ctx, videos, "", outputDir, opts, dirOpts, make(map[string]string))
+	if err != nil {
+		return nil, err
+	}
+	if videos, outputFiles, err = selectWork(videos, outputFiles, opts, dirOpts); err != nil {
+		return nil, err
+	}
+	stats.Total += len(videos)
+
+	if err := runWorkers(ctx, videos, outputFiles, opts, dirOpts, stats); err != nil {
+		return nil, err
+	}
+	printBatchSummary(ctx, stats, opts)
+
+	return stats, nil
+}
+
+// runWorkers convierte los videos con un pool de trabajadores y acumula los
+// resultados en stats. outputFiles tiene la salida planificada de cada video
+func runWorkers(ctx context.Context, videos, outputFiles []string, opts ConversionOptions, dirOpts DirectoryOptions, stats *ConversionStats) error {
+	var resume *resumeState
+	if dirOpts.Resume != "" && !opts.DryRun {
+		var err error
+		if resume, err = openResumeState(dirOpts.Resume); err != nil {
+			return err
+		}
+		defer resume.Close()
+	}
+
+	// Con FailFast el primer error cancela las conversiones en curso y las pendientes
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	start := time.Now()
+	completed := 0
+	record := func(result ConversionResult) {
+		stats.agregarResultado(result)
+		// Un archivo omitido por su duración no cuenta como convertido: si cambian
+		// los límites se tiene que volver a considerar
+		if resume != nil && result.Success && !result.SkippedByDuration {
+			if err := resume.record(result.InputPath); err != nil && !opts.JSON {
+				errorf("Error al registrar %s en %s: %s\n", filepath.Base(result.InputPath), dirOpts.Resume, err)
+			}
+		}
+
+		// Estimar lo que falta con el tiempo promedio de los archivos terminados
+		stats.mu.Lock()
+		completed++
+		done := completed
+		stats.mu.Unlock()
+		if !opts.JSON && len(videos) > 1 && done < len(videos) {
+			elapsed := time.Since(start)
+			remaining := elapsed / time.Duration(done) * time.Duration(len(videos)-done)
+			Infof("  %d/%d completados, %s restantes\n", done, len(videos), formatRemaining(remaining))
+		}
+
+		if dirOpts.FailFast && !result.Success && ctx.Err() == nil {
+			stats.mu.Lock()
+			stats.Aborted = true
+			stats.mu.Unlock()
+			cancel()
+		}
+	}
+
+	// Preparar canal de trabajo
+	type workItem struct {
+		videoPath  string
+		outputFile string
+		index      int
+	}
+
+	// Se deja de tomar trabajos nuevos al cancelar o al pedir el drenado del lote
+	stopped := func() bool {
+		select {
+		case <-dirOpts.Drain:
+			return true
+		default:
+			return ctx.Err() != nil
+		}
+	}
+	processed := len(stats.Results)
+
+	workChan := make(chan workItem, len(videos))
+	for i, video := range videos {
+		workChan <- workItem{video, outputFiles[i], i}
+	}
+	close(workChan)
+
+	var wg sync.WaitGroup
+	numWorkers := dirOpts.MaxWorkers
+	if numWorkers <= 0 {
+		numWorkers = 1
+	}
+	if numWorkers > len(videos) {
+		numWorkers = len(videos)
+	}
+	if numWorkers < dirOpts.MaxWorkers {
+		verbosef("Trabajadores: %d (se pidieron %d, pero hay solo %d videos)\n", numWorkers, dirOpts.MaxWorkers, len(videos))
+	} else {
+		verbosef("Trabajadores: %d\n", numWorkers)
+	}
+
+	// Con varios trabajadores las barras de progreso se pisarían entre sí
+	if numWorkers > 1 {
+		opts.Progress = false
+	}
+
+	// Sin -threads explícito, cada ffmpeg usa solo su parte de los núcleos
+	if opts.Threads <= 0 {
+		opts.Threads = threadsPerWorker(numWorkers)
+		verbosef("Hilos por conversión: %d (automático: %d trabajadores, %d núcleos)\n", opts.Threads, numWorkers, runtime.NumCPU())
+	} else {
+		verbosef("Hilos por conversión: %d (-threads)\n", opts.Threads)
+	}
+	// Más hilos que núcleos no acelera nada: los ffmpeg compiten entre sí y
+	// cada conversión tarda más
+	if total := numWorkers * opts.Threads; total > runtime.NumCPU() {
+		verbosef("Advertencia: %d trabajadores × %d hilos = %d hilos, más que los %d núcleos disponibles; considere bajar -workers o -threads\n",
+			numWorkers, opts.Threads, total, runtime.NumCPU())
+	}
+
+	// Función para procesar un video
+	processVideo := func(item workItem) ConversionResult {
+		videoPath := item.videoPath
+		outputFile := item.outputFile
+		fullOutputDir := filepath.Dir(outputFile)
+
+		// Ya convertido en una ejecución anterior (-resume)
+		if resume != nil && resume.completed(videoPath) {
+			result := ConversionResult{InputPath: videoPath, OutputPath: outputFile, Success: true, Skipped: true}
+			if !opts.JSON {
+				PrintResult(result, opts)
+			}
+			return result
+		}
+
+		// Asegurar que existe el subdirectorio de salida
+		if !opts.DryRun {
+			if err := os.MkdirAll(fullOutputDir, 0755); err != nil {
+				if !opts.JSON {
+					errorf("Error al crear subdirectorio: %s\n", err)
+				}
+				return ConversionResult{InputPath: videoPath, OutputPath: outputFile, Error: err.Error()}
+			}
+		}
+
+		// Comprobar si el archivo ya existe y es más reciente que el original
+		// (con -skip-existing alcanza con que exista; con -overwrite siempre se
+		// reconvierte; en modo simulación se muestra el plan completo)
+		if info, err := os.Stat(outputFile); err == nil && !opts.DryRun && !opts.Overwrite {
+			skip := opts.SkipExisting
+			if !skip {
+				inputInfo, err := os.Stat(videoPath)
+				skip = err == nil && info.ModTime().After(inputInfo.ModTime())
+			}
+			if skip {
+				result := ConversionResult{InputPath: videoPath, OutputPath: outputFile, Success: true, Skipped: true}
+				if !opts.JSON {
+					PrintResult(result, opts)
+				}
+				return result
+			}
+		}
+
+		// Convertir video
+		if !opts.JSON {
+			Infof("Convirtiendo: %s\n", filepath.Base(videoPath))
+		}
+		result, err := ConvertVideo(ctx, videoPath, outputFile, opts)
+		if err != nil {
+			if !opts.JSON {
+				errorf("Error al convertir %s: %s\n", filepath.Base(videoPath), err)
+			}
+			result.Error = err.Error()
+			return result
+		}
+
+		if !opts.DryRun {
+			stats.sumarBytes(result.InputSizeBytes, result.OutputSizeBytes)
+		}
+		if !opts.JSON {
+			PrintResult(result, opts)
+		}
+		return result
+	}
+
+	// Iniciar trabajadores
+	if numWorkers <= 1 {
+		// Modo secuencial
+		for item := range workChan {
+			if stopped() {
+				break
+			}
+			record(processVideo(item))
+		}
+	} else {
+		// Modo paralelo
+		wg.Add(numWorkers)
+		for i := 0; i < numWorkers; i++ {
+			go func() {
+				defer wg.Done()
+				for item := range workChan {
+					// No tomar trabajos nuevos si el proceso fue cancelado o drenado
+					if stopped() {
+						return
+					}
+					record(processVideo(item))
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	stats.Pending = len(videos) - (len(stats.Results) - processed)
+	return nil
+}
+
+// SortOrders son los valores válidos de DirectoryOptions.Sort
+var SortOrders = []string{"name", "size", "size-desc", "mtime"}
+
+// processingOrder devuelve los índices de videos en el orden pedido con -sort:
+// por ruta, por tamaño (ascendente o descendente) o por fecha de modificación
+// (los más viejos primero). Vacío conserva el orden en que se encontraron
+func processingOrder(videos []string, order string) ([]int, error) {
+	indexes := make([]int, len(videos))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	if order == "" {
+		return indexes, nil
+	}
+	if !slices.Contains(SortOrders, order) {
+		return nil, fmt.Errorf("orden inválido: '%s' (valores válidos: %s)", order, strings.Join(SortOrders, ", "))
+	}
+
+	// Un archivo que no se puede leer queda primero; su conversión informará el error
+	infos := make([]fs.FileInfo, len(videos))
+	if order != "name" {
+		for i, video := range videos {
+			infos[i], _ = os.Stat(video)
+		}
+	}
+	size := func(i int) int64 {
+		if infos[i] == nil {
+			return 0
+		}
+		return infos[i].Size()
+	}
+	modTime := func(i int) time.Time {
+		if infos[i] == nil {
+			return time.Time{}
+		}
+		return infos[i].ModTime()
+	}
+	slices.SortStableFunc(indexes, func(a, b int) int {
+		switch order {
+		case "size":
+			return cmp.Compare(size(a), size(b))
+		case "size-desc":
+			return cmp.Compare(size(b), size(a))
+		case "mtime":
+			return modTime(a).Compare(modTime(b))
+		}
+		return strings.Compare(videos[a], videos[b])
+	})
+	return indexes, nil
+}
+
+// selectWork ordena los videos del lote según -sort (o los mezcla con -shuffle)
+// y se queda con los primeros -limit, junto con sus salidas. Las salidas se
+// planifican antes con todos los videos encontrados, así que los nombres
+// generados no dependen del orden ni de cuántos se procesen
+func selectWork(videos, outputFiles []string, opts ConversionOptions, dirOpts DirectoryOptions) ([]string, []string, error) {
+	if dirOpts.Shuffle && dirOpts.Sort != "" {
+		return nil, nil, errors.New("-shuffle y -sort no se pueden usar juntos")
+	}
+	order, err := processingOrder(videos, dirOpts.Sort)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dirOpts.Shuffle {
+		seed := dirOpts.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+			// Con la semilla a la vista se puede repetir la misma muestra
+			if !opts.JSON {
+				Infof("Orden aleatorio (repetible con -seed %d)\n", seed)
+			}
+		}
+		random := rand.New(rand.NewSource(seed))
+		random.Shuffle(len(order), func(i, j int) {
+			order[i], order[j] = order[j], order[i]
+		})
+	}
+	if dirOpts.Limit > 0 && dirOpts.Limit < len(order) {
+		if !opts.JSON {
+			Infof("Procesando %d de %d encontrados (-limit)\n", dirOpts.Limit, len(order))
+		}
+		order = order[:dirOpts.Limit]
+	}
+
+	queued := make([]string, len(order))
+	queuedOutputs := make([]string, len(order))
+	for i, index := range order {
+		queued[i], queuedOutputs[i] = videos[index], outputFiles[index]
+	}
+	return queued, queuedOutputs, nil
+}
+
+// resumeEntry identifica un original convertido; si cambia su tamaño o su fecha
+// se vuelve a convertir
+type resumeEntry struct {
+	Input   string    `json:"input"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// resumeState es el archivo de -resume: una línea JSON por original convertido,
+// agregada apenas termina cada conversión para no perder el avance si se corta
+type resumeState struct {
+	mu   sync.Mutex
+	file *os.File
+	done map[string]resumeEntry
+}
+
+// openResumeState lee las conversiones registradas en path y lo deja abierto
+// para agregar las nuevas
+func openResumeState(path string) (*resumeState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error al leer el estado de -resume: %w", err)
+	}
+
+	state := &resumeState{done: make(map[string]resumeEntry)}
+	for _, line := range strings.Split(string(data), "\n") {
+		var entry resumeEntry
+		// Una línea incompleta (corte durante la escritura) se ignora
+		if json.Unmarshal([]byte(line), &entry) == nil && entry.Input != "" {
+			state.done[entry.Input] = entry
+		}
+	}
+
+	state.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir el estado de -resume: %w", err)
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		state.file.WriteString("\n")
+	}
+	return state, nil
+}
+
+// resumeKey identifica un original por su ruta absoluta
+func resumeKey(path string) (string, os.FileInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", nil, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", nil, err
+	}
+	return abs, info, nil
+}
+
+// completed indica si path ya se convirtió y no cambió desde entonces
+func (state *resumeState) completed(path string) bool {
+	key, info, err := resumeKey(path)
+	if err != nil {
+		return false
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	entry, ok := state.done[key]
+	return ok && entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime())
+}
+
+// record agrega path al estado y lo escribe de inmediato
+func (state *resumeState) record(path string) error {
+	key, info, err := resumeKey(path)
+	if err != nil {
+		// Eliminado con -delete-source: ya no hay nada que retomar
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	entry := resumeEntry{Input: key, Size: info.Size(), ModTime: info.ModTime()}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if previous, ok := state.done[key]; ok && previous.Size == entry.Size && previous.ModTime.Equal(entry.ModTime) {
+		return nil
+	}
+	state.done[key] = entry
+	if _, err := state.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return state.file.Sync()
+}
+
+// Close cierra el archivo de estado
+func (state *resumeState) Close() error {
+	return state.file.Close()
+}
+
+// formatRemaining muestra una duración estimada con precisión de minutos
+func formatRemaining(d time.Duration) string {
+	if d < time.Minute {
+		return "<1m"
+	}
+	d = d.Round(time.Minute)
+	if d < time.Hour {
+		return fmt.Sprintf("~%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("~%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// DefaultWatchInterval es la frecuencia de revisión por defecto de -watch
+const DefaultWatchInterval = 5 * time.Second
+
+// printBatchSummary muestra las estadísticas de un lote al terminar
+func printBatchSummary(ctx context.Context, stats *ConversionStats, opts ConversionOptions) {
+	if !opts.JSON {
+		if stats.Aborted {
+			Infof("\nProceso detenido por un error (-fail-fast):\n")
+		} else if ctx.Err() != nil || stats.Pending > 0 {
+			Infof("\nProceso interrumpido:\n")
+		} else {
+			Infof("\nProceso completado:\n")
+		}
+		Infof("- Total procesados: %d\n", stats.Total)
+		Infof("- Conversiones exitosas: %d\n", stats.Exito)
+		Infof("- Errores: %d\n", stats.Error)
+		if stats.Pending > 0 {
+			Infof("- Sin procesar: %d\n", stats.Pending)
+		}
+		if stats.SkippedBySize > 0 {
+			Infof("- Omitidos por tamaño: %d\n", stats.SkippedBySize)
+		}
+		if stats.SkippedByDuration > 0 {
+			Infof("- Omitidos por duración: %d\n", stats.SkippedByDuration)
+		}
+		if stats.TotalInputBytes > 0 {
+			Infof("- Espacio ahorrado: %.2f MB (la salida ocupa el %.1f%% del original)\n",
+				float64(stats.SavedBytes())/(1024*1024),
+				float64(stats.TotalOutputBytes)/float64(stats.TotalInputBytes)*100)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package pyxelart
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchSkipsOutputDir(t *testing.T) {
+	dir := t.TempDir()
+	writeClip(t, dir, "clip.mp4")
+
+	// La salida por defecto (dir/mp4) queda dentro del directorio vigilado y
+	// tiene una extensión de video: no se debe tomar como un original nuevo
+	opts := DefaultOptions()
+	opts.OutputFormat = "mp4"
+	runner := &mockRunner{}
+	converter := Converter{
+		Options:   opts,
+		Runner:    runner,
+		Directory: DirectoryOptions{Recursive: true, Watch: true, WatchInterval: 5 * time.Millisecond},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	stats, err := converter.ConvertDir(ctx, dir, "")
+	if err != nil {
+		t.Fatalf("ConvertDir: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "mp4", "clip.mp4")); err != nil {
+		t.Fatalf("no se generó la salida: %v", err)
+	}
+	if stats.Total != 1 || len(runner.runCalls) != 1 {
+		t.Errorf("Total = %d, %d ejecuciones de ffmpeg; la salida se volvió a convertir", stats.Total, len(runner.runCalls))
+	}
+
+	// Una segunda corrida recursiva tampoco encuentra las salidas
+	videos, _, err := findVideos(dir, defaultOutputDir(dir, opts), converter.Directory)
+	if err != nil || len(videos) != 1 {
+		t.Errorf("findVideos = %v, %v; se esperaba solo el original", videos, err)
+	}
+}
+
+func TestWatchOutputCollision(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	writeClip(t, dir, "my_video.mp4")
+
+	runner := &mockRunner{}
+	converter := Converter{
+		Options:   DefaultOptions(),
+		Runner:    runner,
+		Directory: DirectoryOptions{Watch: true, WatchInterval: 5 * time.Millisecond},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	done := make(chan *ConversionStats)
+	go func() {
+		stats, err := converter.ConvertDir(ctx, dir, out)
+		if err != nil {
+			t.Errorf("ConvertDir: %v", err)
+		}
+		done <- stats
+	}()
+
+	// El segundo original llega en otra revisión, con un nombre que genera la
+	// misma salida que el primero
+	for runs := 0; runs == 0; time.Sleep(5 * time.Millisecond) {
+		runner.mu.Lock()
+		runs = len(runner.runCalls)
+		runner.mu.Unlock()
+	}
+	writeClip(t, dir, "My Video.mp4")
+	stats := <-done
+
+	if stats == nil || stats.Total != 2 || len(runner.runCalls) != 2 {
+		t.Fatalf("stats = %+v, %d ejecuciones de ffmpeg; se esperaban las dos conversiones", stats, len(runner.runCalls))
+	}
+	for _, name := range []string{"my_video.webm", "my_video_2.webm"} {
+		if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+			t.Errorf("falta la salida %s: %v", name, err)
+		}
+	}
+
+	// Con -on-collision error el choque con una salida ya asignada también falla
+	owners := map[string]string{filepath.Join(out, "my_video.webm"): filepath.Join(dir, "my_video.mp4")}
+	dirOpts := DirectoryOptions{OnCollision: "error"}
+	if _, err := planOutputs(context.Background(), []string{filepath.Join(dir, "My Video.mp4")}, dir, out, DefaultOptions(), dirOpts, owners); err == nil {
+		t.Error("se esperaba un error por la salida repetida")
+	}
+}
+
+func TestProcessingOrder(t *testing.T) {
+	dir := t.TempDir()
+	// Tamaño y antigüedad en órdenes distintos al alfabético
+	files := []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{"a.mp4", 300, 2 * time.Hour},
+		{"b.mp4", 100, time.Hour},
+		{"c.mp4", 200, 3 * time.Hour},
+	}
+	var videos []string
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, make([]byte, f.size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(-f.age)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		videos = append(videos, path)
+	}
+	videos[0], videos[2] = videos[2], videos[0]
+
+	for order, want := range map[string]string{
+		"":          "c,b,a",
+		"name":      "a,b,c",
+		"size":      "b,c,a",
+		"size-desc": "a,c,b",
+		"mtime":     "c,a,b",
+	} {
+		indexes, err := processingOrder(videos, order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, i := range indexes {
+			names = append(names, strings.TrimSuffix(filepath.Base(videos[i]), ".mp4"))
+		}
+		if got := strings.Join(names, ","); got != want {
+			t.Errorf("orden %q: %s, se esperaba %s", order, got, want)
+		}
+	}
+	if _, err := processingOrder(videos, "random"); err == nil {
+		t.Error("se esperaba un error con un orden desconocido")
+	}
+}
+
+func TestConvertDirLimit(t *testing.T) {
+	dir := t.TempDir()
+	for i, name := range []string{"a.mp4", "b.mp4", "c.mp4"} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, 1000*(i+1)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	converter := Converter{
+		Options:   DefaultOptions(),
+		Runner:    &mockRunner{},
+		Directory: DirectoryOptions{Sort: "size-desc", Limit: 2},
+	}
+	stats, err := converter.ConvertDir(context.Background(), dir, filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatalf("ConvertDir: %v", err)
+	}
+	var converted []string
+	for _, result := range stats.Results {
+		converted = append(converted, filepath.Base(result.InputPath))
+	}
+	if stats.Total != 2 || !slices.Equal(converted, []string{"c.mp4", "b.mp4"}) {
+		t.Errorf("Total = %d, convertidos = %v; se esperaban los dos más grandes", stats.Total, converted)
+	}
+}
+
+func TestSelectWorkShuffle(t *testing.T) {
+	var videos, outputs []string
+	for i := range 20 {
+		videos = append(videos, "video"+strconv.Itoa(i)+".mp4")
+		outputs = append(outputs, "video"+strconv.Itoa(i)+".webm")
+	}
+	opts := ConversionOptions{JSON: true}
+	dirOpts := DirectoryOptions{Shuffle: true, Seed: 42, Limit: 5}
+
+	first, firstOutputs, err := selectWork(videos, outputs, opts, dirOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, _ := selectWork(videos, outputs, opts, dirOpts)
+	if len(first) != 5 || !slices.Equal(first, second) {
+		t.Errorf("con la misma semilla se esperaba la misma muestra: %v y %v", first, second)
+	}
+	if slices.Equal(first, videos[:5]) {
+		t.Errorf("la muestra conserva el orden original: %v", first)
+	}
+	for i, video := range first {
+		if firstOutputs[i] != strings.TrimSuffix(video, ".mp4")+".webm" {
+			t.Errorf("la salida de %s es %s", video, firstOutputs[i])
+		}
+	}
+
+	dirOpts.Sort = "size"
+	if _, _, err := selectWork(videos, outputs, opts, dirOpts); err == nil {
+		t.Error("se esperaba un error con -shuffle y -sort juntos")
+	}
+}
@@ -0,0 +1,146 @@
+package pyxelart
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+)
+
+// DefaultBenchSample es la duración en segundos del fragmento que codifica cada
+// combinación de Benchmark si opts.Sample no indica otra
+const DefaultBenchSample = 10
+
+// benchSizeTolerance es cuánto más grande que la salida más chica puede ser la
+// de la combinación recomendada (con -crf los presets lentos comprimen mejor)
+const benchSizeTolerance = 0.05
+
+// BenchCase es una combinación de preset e hilos a medir
+type BenchCase struct {
+	Preset  string `json:"preset"`
+	Threads int    `json:"threads"`
+}
+
+// BenchResult es la medición de una combinación
+type BenchResult struct {
+	BenchCase
+	Seconds     float64 `json:"elapsed_seconds"`
+	OutputBytes int64   `json:"output_bytes"`
+	Speed       float64 `json:"speed"` // Segundos de video codificados por segundo
+	Error       string  `json:"error,omitempty"`
+}
+
+// DefaultBenchCases combina los tres presets con un hilo, la mitad de los núcleos
+// y todos (hasta el máximo automático)
+func DefaultBenchCases() []BenchCase {
+	threads := []int{1}
+	for _, n := range []int{runtime.NumCPU() / 2, defaultThreads()} {
+		if n > 1 && !slices.Contains(threads, n) {
+			threads = append(threads, n)
+		}
+	}
+
+	var cases []BenchCase
+	for _, preset := range []string{"fast", "balanced", "slow"} {
+		for _, n := range threads {
+			cases = append(cases, BenchCase{Preset: preset, Threads: n})
+		}
+	}
+	return cases
+}
+
+// Benchmark codifica el mismo fragmento de input con cada combinación de cases
+// y mide el tiempo y el tamaño de cada salida. El fragmento dura opts.Sample
+// segundos (DefaultBenchSample si es 0); las salidas se descartan al terminar.
+// Una combinación que falla queda registrada con su error y se sigue con la próxima
+func Benchmark(ctx context.Context, input string, opts ConversionOptions, cases []BenchCase) ([]BenchResult, error) {
+	if len(cases) == 0 {
+		return nil, errors.New("no hay combinaciones para medir")
+	}
+	if _, err := os.Stat(input); err != nil {
+		return nil, classify(ErrInputNotFound, fmt.Errorf("el archivo '%s' no existe", input))
+	}
+
+	outDir, err := os.MkdirTemp("", "pyxelart-bench-")
+	if err != nil {
+		return nil, fmt.Errorf("error al crear el directorio temporal: %w", err)
+	}
+	defer os.RemoveAll(outDir)
+
+	if opts.Sample <= 0 {
+		opts.Sample = DefaultBenchSample
+	}
+	// Solo interesa la codificación: nada de pasos extra ni efectos sobre el original
+	opts.DryRun = false
+	opts.Progress = false
+	opts.ProgressJSON = nil
+	opts.Thumbnail = false
+	opts.Verify = false
+	opts.DeleteSource = false
+	opts.SkipExisting = false
+
+	for _, c := range cases {
+		if c.Threads < 1 {
+			return nil, fmt.Errorf("cantidad de hilos inválida: %d", c.Threads)
+		}
+		if _, err := lookupPreset(c.Preset); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]BenchResult, 0, len(cases))
+	for i, c := range cases {
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+		caseOpts := opts
+		caseOpts.Preset = c.Preset
+		caseOpts.Threads = c.Threads
+
+		if !opts.JSON {
+			Infof("[%d/%d] preset %s, %d hilos\n", i+1, len(cases), c.Preset, c.Threads)
+		}
+		output := filepath.Join(outDir, fmt.Sprintf("bench_%s_%d%s", c.Preset, c.Threads, outputExtension(opts)))
+		conversion, err := ConvertVideo(ctx, input, output, caseOpts)
+
+		result := BenchResult{BenchCase: c, Seconds: conversion.Elapsed.Seconds()}
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.OutputBytes = conversion.OutputSizeBytes
+			// Si el original es más corto que el fragmento se usa la duración de la salida
+			if duration := cmp.Or(conversion.TrimmedDuration, conversion.OutputDuration); duration > 0 && result.Seconds > 0 {
+				result.Speed = duration / result.Seconds
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// RecommendBench elige la combinación más rápida entre las que no generan una
+// salida mucho más grande que la más chica. Devuelve false si todas fallaron
+func RecommendBench(results []BenchResult) (BenchResult, bool) {
+	var smallest int64
+	for _, r := range results {
+		if r.Error == "" && (smallest == 0 || r.OutputBytes < smallest) {
+			smallest = r.OutputBytes
+		}
+	}
+
+	var best BenchResult
+	found := false
+	for _, r := range results {
+		if r.Error != "" || float64(r.OutputBytes) > float64(smallest)*(1+benchSizeTolerance) {
+			continue
+		}
+		if !found || r.Seconds < best.Seconds {
+			best, found = r, true
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,55 @@
+package pyxelart
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestBenchmark(t *testing.T) {
+	input := writeClip(t, t.TempDir(), "clip.mp4")
+
+	runner := &mockRunner{}
+	opts := DefaultOptions()
+	opts.JSON = true
+	converter := Converter{Options: opts, Runner: runner}
+	cases := []BenchCase{{"fast", 1}, {"slow", 2}}
+	results, err := converter.Bench(context.Background(), input, cases)
+	if err != nil {
+		t.Fatalf("Bench: %v", err)
+	}
+	if len(results) != 2 || len(runner.runCalls) != 2 {
+		t.Fatalf("se esperaban 2 mediciones: %d resultados, %d ejecuciones", len(results), len(runner.runCalls))
+	}
+	for i, args := range runner.runCalls {
+		if got, _ := argValue(args, "-t"); got != "10" {
+			t.Errorf("combinación %d: -t = %q, se esperaba el fragmento de %d segundos", i, got, DefaultBenchSample)
+		}
+		if got, _ := argValue(args, "-threads"); got != strconv.Itoa(cases[i].Threads) {
+			t.Errorf("combinación %d: -threads = %q", i, got)
+		}
+		if results[i].Error != "" || results[i].OutputBytes != 1024 {
+			t.Errorf("combinación %d: %+v", i, results[i])
+		}
+	}
+
+	if _, err := converter.Bench(context.Background(), input, []BenchCase{{"turbo", 1}}); err == nil {
+		t.Error("un preset inválido debería fallar antes de convertir")
+	}
+}
+
+func TestRecommendBench(t *testing.T) {
+	results := []BenchResult{
+		{BenchCase: BenchCase{"fast", 4}, Seconds: 1, OutputBytes: 1500},
+		{BenchCase: BenchCase{"balanced", 4}, Seconds: 2, OutputBytes: 1040},
+		{BenchCase: BenchCase{"slow", 4}, Seconds: 5, OutputBytes: 1000},
+		{BenchCase: BenchCase{"slow", 1}, Error: "falló"},
+	}
+	best, ok := RecommendBench(results)
+	if !ok || best.Preset != "balanced" {
+		t.Errorf("RecommendBench = %+v, %v; se esperaba balanced", best, ok)
+	}
+	if _, ok := RecommendBench(results[3:]); ok {
+		t.Error("sin mediciones válidas no debería recomendar nada")
+	}
+}
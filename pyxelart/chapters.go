@@ -0,0 +1,87 @@
+package pyxelart
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Chapter es un capítulo del original según sus marcas de capítulo
+type Chapter struct {
+	Title string  `json:"title,omitempty"`
+	Start float64 `json:"start_seconds"`
+	End   float64 `json:"end_seconds"`
+}
+
+// chapterFileName arma el nombre de la salida de un capítulo a partir del nombre
+// de salida del video completo: "clip.webm" -> "clip_02_la_entrevista.webm"
+func chapterFileName(name string, number int, title string) string {
+	ext := filepath.Ext(name)
+	chapterName := fmt.Sprintf("%s_%02d", strings.TrimSuffix(name, ext), number)
+	// snakeCaseFilename descarta la extensión, así que los puntos del título no
+	// deben confundirse con una
+	if slug := snakeCaseFilename(strings.ReplaceAll(title, ".", " ")); slug != "" {
+		chapterName += "_" + slug
+	}
+	return chapterName + ext
+}
+
+// ConvertChapters convierte cada capítulo del original en un archivo propio dentro
+// de outputDir (vacío = junto al original). Un capítulo que falla no detiene a los
+// demás: su error queda en el resultado y se informa al final
+func ConvertChapters(ctx context.Context, inputVideo, outputDir string, opts ConversionOptions) ([]ConversionResult, error) {
+	info, err := probeVideo(ctx, opts.run(), opts.ffprobe(), inputVideo)
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener información del video: %w", err)
+	}
+	if len(info.Chapters) == 0 {
+		return nil, fmt.Errorf("el video '%s' no tiene marcas de capítulo", inputVideo)
+	}
+	if outputDir == "" {
+		outputDir = filepath.Dir(inputVideo)
+	}
+	name := outputFileName(inputVideo, opts, info)
+
+	var results []ConversionResult
+	failed := 0
+	for i, chapter := range info.Chapters {
+		if ctx.Err() != nil {
+			break
+		}
+		if chapter.End <= chapter.Start {
+			continue
+		}
+
+		chapterOpts := opts
+		chapterOpts.StartTime = strconv.FormatFloat(chapter.Start, 'f', -1, 64)
+		chapterOpts.EndTime = strconv.FormatFloat(chapter.End, 'f', -1, 64)
+		outputPath := filepath.Join(outputDir, chapterFileName(name, i+1, chapter.Title))
+
+		if !opts.JSON {
+			Infof("Capítulo %d/%d: %s (%.2f - %.2f segundos)\n", i+1, len(info.Chapters),
+				cmp.Or(chapter.Title, "sin título"), chapter.Start, chapter.End)
+		}
+		result, err := ConvertVideo(ctx, inputVideo, outputPath, chapterOpts)
+		if err != nil {
+			if !opts.JSON {
+				errorf("Error al convertir el capítulo %d: %s\n", i+1, err)
+			}
+			result.Error = err.Error()
+			failed++
+		} else if !opts.JSON {
+			PrintResult(result, chapterOpts)
+		}
+		results = append(results, result)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return results, err
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("%d de %d capítulos no se pudieron convertir", failed, len(results))
+	}
+	return results, nil
+}
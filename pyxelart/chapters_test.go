@@ -0,0 +1,47 @@
+package pyxelart
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertChapters(t *testing.T) {
+	dir := t.TempDir()
+	input := writeClip(t, dir, "Long Talk.mp4")
+	runner := &mockRunner{chapters: `{"chapters":[
+		{"start_time":"0.000000","end_time":"4.500000","tags":{"title":"Intro"}},
+		{"start_time":"4.500000","end_time":"10.000000","tags":{}}]}`}
+
+	opts := DefaultOptions()
+	opts.runner = runner
+	results, err := ConvertChapters(context.Background(), input, filepath.Join(dir, "out"), opts)
+	if err != nil {
+		t.Fatalf("ConvertChapters: %v", err)
+	}
+	if len(results) != 2 || len(runner.runCalls) != 2 {
+		t.Fatalf("se esperaban 2 capítulos convertidos: %d resultados, %d ejecuciones", len(results), len(runner.runCalls))
+	}
+
+	wantOutputs := []string{"long_talk_01_intro.webm", "long_talk_02.webm"}
+	wantRanges := [][2]string{{"0", "4.5"}, {"4.5", "10"}}
+	for i, args := range runner.runCalls {
+		if got := filepath.Base(results[i].OutputPath); got != wantOutputs[i] {
+			t.Errorf("capítulo %d: salida %q, se esperaba %q", i+1, got, wantOutputs[i])
+		}
+		ss, _ := argValue(args, "-ss")
+		to, _ := argValue(args, "-to")
+		if ss != wantRanges[i][0] || to != wantRanges[i][1] {
+			t.Errorf("capítulo %d: -ss %s -to %s, se esperaba -ss %s -to %s", i+1, ss, to, wantRanges[i][0], wantRanges[i][1])
+		}
+	}
+}
+
+func TestConvertChaptersWithoutChapters(t *testing.T) {
+	input := writeClip(t, t.TempDir(), "clip.mp4")
+	opts := DefaultOptions()
+	opts.runner = &mockRunner{chapters: `{"chapters":[]}`}
+	if _, err := ConvertChapters(context.Background(), input, "", opts); err == nil {
+		t.Error("se esperaba un error para un video sin capítulos")
+	}
+}
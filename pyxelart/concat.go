@@ -0,0 +1,103 @@
+package pyxelart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// concatInput describe los archivos que ConvertVideo recibe unidos en una lista
+// del demuxer concat
+type concatInput struct {
+	info          *VideoInfo // Información combinada: tamaño del primero, duración total
+	width, height int        // Tamaño común al que se ajustan todos (0 = ya coinciden)
+	size          int64      // Suma del tamaño de los originales
+}
+
+// concatListLine arma la línea de un archivo en la lista del demuxer concat, que
+// encierra la ruta entre comillas simples: cada comilla de la ruta cierra el
+// texto, se agrega escapada y se vuelve a abrir
+func concatListLine(path string) string {
+	return "file '" + strings.ReplaceAll(filepath.ToSlash(path), "'", `'\''`) + "'\n"
+}
+
+// ConcatVideos une inputs, en orden, en un único video. Si los tamaños no
+// coinciden se ajustan al del primero; si alguno no tiene audio el resultado sale
+// sin audio. outputPath vacío deja la salida junto al primero con el sufijo _joined
+func ConcatVideos(ctx context.Context, inputs []string, outputPath string, opts ConversionOptions) (ConversionResult, error) {
+	result := ConversionResult{InputPath: strings.Join(inputs, ", ")}
+	if len(inputs) < 2 {
+		return result, errors.New("se necesitan al menos dos archivos para unirlos")
+	}
+	if opts.DeleteSource {
+		return result, errors.New("-delete-source no se puede usar al unir archivos")
+	}
+	if _, index, _ := parseSubtitles(opts.Subtitles); opts.Subtitles != "" && index >= 0 {
+		return result, errors.New("al unir archivos solo se pueden incrustar subtítulos de un archivo externo")
+	}
+
+	concat := &concatInput{}
+	var warnings []string
+	var list strings.Builder
+	for i, input := range inputs {
+		stat, err := os.Stat(input)
+		if os.IsNotExist(err) {
+			return result, classify(ErrInputNotFound, fmt.Errorf("el archivo '%s' no existe", input))
+		}
+		info, err := probeVideo(ctx, opts.run(), opts.ffprobe(), input)
+		if err != nil {
+			return result, fmt.Errorf("error al obtener información de '%s': %w", input, err)
+		}
+		absPath, err := filepath.Abs(input)
+		if err != nil {
+			return result, err
+		}
+		list.WriteString(concatListLine(absPath))
+		concat.size += stat.Size()
+
+		if i == 0 {
+			first := *info
+			concat.info = &first
+			continue
+		}
+		concat.info.Duration += info.Duration
+		if info.Width != concat.info.Width || info.Height != concat.info.Height {
+			concat.width, concat.height = concat.info.Width, concat.info.Height
+		}
+		if !info.HasAudio && concat.info.HasAudio {
+			concat.info.HasAudio = false
+			warnings = append(warnings, fmt.Sprintf("%s no tiene audio; el resultado sale sin audio", filepath.Base(input)))
+		}
+	}
+	if concat.width > 0 {
+		warnings = append(warnings, fmt.Sprintf("los archivos tienen tamaños distintos; se ajustan a %dx%d", concat.width, concat.height))
+	}
+	opts.concat = concat
+
+	listFile, err := os.CreateTemp("", "pyxelart-concat-*.txt")
+	if err != nil {
+		return result, fmt.Errorf("error al crear la lista de archivos: %w", err)
+	}
+	defer os.Remove(listFile.Name())
+	if _, err := listFile.WriteString(list.String()); err != nil {
+		listFile.Close()
+		return result, fmt.Errorf("error al escribir la lista de archivos: %w", err)
+	}
+	if err := listFile.Close(); err != nil {
+		return result, fmt.Errorf("error al escribir la lista de archivos: %w", err)
+	}
+
+	if outputPath == "" {
+		name := outputFileName(inputs[0], opts, concat.info)
+		ext := filepath.Ext(name)
+		outputPath = filepath.Join(filepath.Dir(inputs[0]), strings.TrimSuffix(name, ext)+"_joined"+ext)
+	}
+
+	result, err = ConvertVideo(ctx, listFile.Name(), outputPath, opts)
+	result.InputPath = strings.Join(inputs, ", ")
+	result.Warnings = append(warnings, result.Warnings...)
+	return result, err
+}
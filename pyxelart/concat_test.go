@@ -0,0 +1,42 @@
+package pyxelart
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestConcatVideos(t *testing.T) {
+	dir := t.TempDir()
+	var inputs []string
+	for _, name := range []string{"a.mp4", "it's b.mp4"} {
+		inputs = append(inputs, writeClip(t, dir, name))
+	}
+
+	runner := &mockRunner{}
+	opts := DefaultOptions()
+	opts.runner = runner
+	result, err := ConcatVideos(context.Background(), inputs, "", opts)
+	if err != nil {
+		t.Fatalf("ConcatVideos: %v", err)
+	}
+	if want := filepath.Join(dir, "a_joined.webm"); result.OutputPath != want {
+		t.Errorf("salida %q, se esperaba %q", result.OutputPath, want)
+	}
+	if result.InputSizeBytes != 2*4096 {
+		t.Errorf("tamaño de entrada %d, se esperaba la suma de los originales", result.InputSizeBytes)
+	}
+
+	args := runner.runCalls[0]
+	i := slices.Index(args, "-i")
+	if i < 4 || !slices.Equal(args[i-4:i], []string{"-f", "concat", "-safe", "0"}) {
+		t.Errorf("se esperaba el demuxer concat antes de -i: %v", args)
+	}
+}
+
+func TestConcatListLine(t *testing.T) {
+	if got, want := concatListLine("/videos/it's.mp4"), `file '/videos/it'\''s.mp4'`+"\n"; got != want {
+		t.Errorf("concatListLine = %q, se esperaba %q", got, want)
+	}
+}
@@ -0,0 +1,1469 @@
+package pyxelart
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConvertVideo convierte un video al formato elegido (WebM por defecto) y devuelve el resultado;
+// la presentación queda a cargo de quien la llama
+func ConvertVideo(ctx context.Context, inputVideo, outputPath string, opts ConversionOptions) (ConversionResult, error) {
+	result := ConversionResult{InputPath: inputVideo}
+	start := time.Now()
+	opts.progressInput = inputVideo
+
+	// Entrada por stdin: ffprobe no puede analizar un pipe ni ffmpeg releerlo
+	// (dos pasadas, miniatura), así que primero se guarda en un archivo temporal
+	if inputVideo == StdioPath {
+		if outputPath == "" {
+			return result, errors.New("con la entrada desde stdin hay que indicar la salida")
+		}
+		if opts.DryRun {
+			// Sin leer stdin no hay video que analizar
+			return result, errors.New("-dry-run no admite la entrada desde stdin")
+		}
+		buffered, err := bufferStdin(opts.TmpDir)
+		if err != nil {
+			return result, err
+		}
+		defer os.Remove(buffered)
+		inputVideo = buffered
+	}
+	if outputPath == StdioPath && opts.Thumbnail {
+		return result, errors.New("-thumbnail no se puede usar con la salida en stdout")
+	}
+
+	// Límite de tiempo por archivo
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	if opts.Threads <= 0 {
+		opts.Threads = defaultThreads()
+	}
+
+	// Verificar si el video existe
+	if _, err := os.Stat(inputVideo); os.IsNotExist(err) {
+		return result, classify(ErrInputNotFound, fmt.Errorf("el archivo '%s' no existe", inputVideo))
+	}
+
+	// Obtener información del video (al unir archivos ya se analizó cada uno)
+	var videoInfo *VideoInfo
+	var err error
+	if opts.concat != nil {
+		videoInfo = opts.concat.info
+	} else if videoInfo, err = probeVideo(ctx, opts.run(), opts.ffprobe(), inputVideo); err != nil {
+		return result, fmt.Errorf("error al obtener información del video: %w", err)
+	}
+	verbosef("Original: %dx%d, %s, %.2f fps, %d kbps, %.2f segundos\n",
+		videoInfo.Width, videoInfo.Height, videoInfo.Codec, videoInfo.FPS, videoInfo.Bitrate/1000, videoInfo.Duration)
+
+	// Originales fuera del rango de -min-duration/-max-duration: se omiten sin convertir
+	if opts.MinDuration != "" || opts.MaxDuration != "" {
+		if videoInfo.Duration <= 0 {
+			result.Warnings = append(result.Warnings, "ffprobe no informó la duración; no se aplican -min-duration ni -max-duration")
+		} else if reason := durationSkipReason(videoInfo.Duration, opts); reason != "" {
+			result.Success = true
+			result.Skipped = true
+			result.SkippedByDuration = true
+			result.SkipReason = reason
+			return result, nil
+		}
+	}
+
+	// Sin alfa en el original, -alpha solo agregaría un plano opaco
+	if opts.Alpha && !videoInfo.HasAlpha {
+		result.Warnings = append(result.Warnings, "el original no tiene canal alfa; se convierte sin transparencia")
+		opts.Alpha = false
+	}
+
+	// Segmento a convertir: la duración efectiva se usa para el progreso y la miniatura
+	duration := videoInfo.Duration
+	if opts.StartTime != "" || opts.EndTime != "" {
+		start, _ := parseTimestamp(opts.StartTime)
+		end, _ := parseTimestamp(opts.EndTime)
+		if duration > 0 && start >= duration {
+			return result, fmt.Errorf("el inicio (%s) está después del final del video (%.2f segundos)", opts.StartTime, duration)
+		}
+		if end > 0 && (duration == 0 || end < duration) {
+			duration = end
+		}
+		duration -= start
+		result.TrimmedDuration = duration
+	}
+	if opts.Sample > 0 && (duration == 0 || opts.Sample < duration) {
+		duration = opts.Sample
+		result.TrimmedDuration = duration
+	}
+
+	// Con -loop-to la salida dura exactamente lo pedido
+	var loops int
+	if opts.LoopTo != "" {
+		target, _ := parseTimestamp(opts.LoopTo)
+		if duration <= 0 {
+			return result, errors.New("-loop-to requiere conocer la duración del video y ffprobe no la informó")
+		}
+		loops = streamLoopCount(duration, target)
+		verbosef("-loop-to: %d repeticiones extra para llegar a %.2f segundos\n", loops, target)
+		duration = target
+		result.TrimmedDuration = duration
+	}
+
+	if opts.Boomerang {
+		if duration > boomerangWarnSeconds {
+			result.Warnings = append(result.Warnings, fmt.Sprintf(
+				"el clip dura %.0f segundos; -boomerang guarda todos sus cuadros en memoria (considera -start/-end)", duration))
+		}
+		// La salida contiene el clip y su reverso
+		duration *= 2
+	}
+	if changesSpeed(opts) {
+		duration /= opts.Speed
+	}
+
+	// El fundido de salida empieza a contar desde el final del video generado, ya
+	// recortado y con la velocidad cambiada
+	if opts.FadeOut > 0 && duration <= 0 {
+		return result, errors.New("-fade-out requiere conocer la duración del video y ffprobe no la informó")
+	}
+	if fades := opts.FadeIn + opts.FadeOut; duration > 0 && fades > duration {
+		return result, fmt.Errorf("los fundidos suman %.2f segundos, más que la salida (%.2f segundos)", fades, duration)
+	}
+
+	// Determinar ruta de salida
+	if outputPath == "" {
+		dir := filepath.Dir(inputVideo)
+		filename := outputFileName(inputVideo, opts, videoInfo)
+		outputPath = filepath.Join(dir, filename)
+	}
+	result.OutputPath = outputPath
+
+	// ffmpeg no puede leer y escribir el mismo archivo a la vez
+	if filepath.Clean(outputPath) == filepath.Clean(inputVideo) {
+		return result, fmt.Errorf("la salida '%s' es el mismo archivo de entrada", outputPath)
+	}
+
+	// Omitir si la salida ya existe y así se pidió
+	if opts.SkipExisting && !opts.DryRun && outputPath != StdioPath {
+		if _, err := os.Stat(outputPath); err == nil {
+			result.Success = true
+			result.Skipped = true
+			return result, nil
+		}
+	}
+
+	// Preparar directorio de salida
+	if !opts.DryRun {
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+			return result, fmt.Errorf("error al crear directorio de salida: %w", err)
+		}
+	}
+
+	// Bitrate de video (kbps): el indicado con -bitrate, el que entra en -target-size
+	// o el que corresponde a la calidad
+	bitrate := qualityToBitrate(opts.Quality)
+	if opts.Bitrate != "" {
+		bitrate, _ = parseBitrate(opts.Bitrate)
+	}
+	audioKbps := 0
+	if videoInfo.HasAudio && !opts.NoAudio && !opts.Boomerang {
+		audioKbps = audioBitrateKbps(opts.AudioBitrate)
+	}
+	if opts.TargetSize > 0 {
+		var warning string
+		bitrate, warning, err = targetBitrate(opts.TargetSize, duration, audioKbps)
+		if err != nil {
+			return result, err
+		}
+		if warning != "" {
+			result.Warnings = append(result.Warnings, warning)
+		}
+		verbosef("Bitrate para -target-size: %d kbps de video + %d kbps de audio\n", bitrate, audioKbps)
+	}
+
+	// ffmpeg escribe en un archivo .part que recién se renombra a outputPath
+	// cuando la conversión y la verificación terminan bien, así la salida nunca
+	// queda a medio escribir. Ante cualquier falla el .part se elimina
+	encodePath := outputPath
+	keepPart := false
+	if !opts.DryRun {
+		if encodePath, err = tempOutputPath(outputPath, opts.TmpDir); err != nil {
+			return result, err
+		}
+		defer func() {
+			if !keepPart {
+				os.Remove(encodePath)
+			}
+		}()
+	}
+
+	// Un disco lleno a mitad de la conversión deja una salida corrupta y hace
+	// fallar también a los archivos siguientes: mejor no empezar
+	if !opts.DryRun {
+		expected := estimatedBytes(bitrate, audioKbps, duration)
+		if opts.TargetSize > 0 {
+			expected = opts.TargetSize
+		}
+		if err := checkFreeSpace(filepath.Dir(encodePath), expected, opts.MinFree); err != nil {
+			return result, err
+		}
+	}
+
+	// Aceleración por hardware: si el encoder no está en esta instalación de
+	// ffmpeg se sigue por software en lugar de fallar
+	var hwAccel hwAccelSpec
+	useHW := false
+	if opts.HWAccel != "" {
+		hwAccel = hwAccelerators[strings.ToLower(opts.HWAccel)]
+		if hasEncoder(opts, hwAccel.Encoder) {
+			useHW = true
+		} else {
+			result.Warnings = append(result.Warnings, fmt.Sprintf(
+				"el encoder %s no está disponible; se usa codificación por software", hwAccel.Encoder))
+		}
+	}
+
+	// Con un tamaño objetivo la segunda pasada reparte los bits según el análisis
+	// de la primera y el tamaño final queda mucho más cerca del pedido
+	if opts.TargetSize > 0 && !useHW {
+		opts.TwoPass = true
+	}
+
+	// Construir comando ffmpeg
+	args := []string{"-y"}
+
+	// Reducir verbosidad si no está en modo verbose
+	if !opts.Verbose {
+		args = append(args, "-v", "warning")
+	}
+
+	if useHW {
+		args = append(args, hwAccel.InitArgs...)
+	}
+
+	// Con -autorotate el giro se aplica con filtros propios, así que se desactiva
+	// el que ffmpeg hace por su cuenta para no rotar dos veces
+	if opts.Autorotate {
+		args = append(args, "-noautorotate")
+	}
+
+	// -ss y -to antes de -i: ffmpeg salta directamente al segmento sin decodificar
+	// lo anterior
+	if opts.StartTime != "" {
+		args = append(args, "-ss", opts.StartTime)
+	}
+	if opts.EndTime != "" {
+		args = append(args, "-to", opts.EndTime)
+	}
+	if opts.Sample > 0 {
+		args = append(args, "-t", strconv.FormatFloat(opts.Sample, 'f', -1, 64))
+	}
+
+	// El decodificador nativo de VP8/VP9 descarta el alfa de un WebM: libvpx lo conserva
+	if opts.Alpha {
+		switch videoInfo.Codec {
+		case "vp8":
+			args = append(args, "-c:v", "libvpx")
+		case "vp9":
+			args = append(args, "-c:v", "libvpx-vp9")
+		}
+	}
+	if opts.concat != nil {
+		// -safe 0 admite rutas absolutas en la lista
+		args = append(args, "-f", "concat", "-safe", "0")
+	}
+	if loops > 0 {
+		args = append(args, "-stream_loop", strconv.Itoa(loops))
+	}
+	args = append(args, "-i", inputVideo)
+	if opts.LoopTo != "" {
+		args = append(args, "-t", strconv.FormatFloat(duration, 'f', -1, 64))
+	}
+
+	// Filtros de video
+	isGIF := opts.OutputFormat == "gif"
+	filters, err := videoFilters(inputVideo, videoInfo, duration, opts)
+	if err != nil {
+		return result, err
+	}
+
+	// Los filtros anteriores trabajan en memoria; al final se suben los cuadros a la GPU
+	if useHW && hwAccel.Upload != "" {
+		filters = append(filters, hwAccel.Upload)
+	}
+
+	// Agregar filtros al comando
+	videoFilter := strings.Join(filters, ",")
+	if videoFilter != "" {
+		args = append(args, "-vf", videoFilter)
+	}
+
+	// Configuración de codificación según el formato
+	codecArgs, warning, err := encoderArgs(videoInfo, bitrate, hwAccel, useHW, opts)
+	if err != nil {
+		return result, err
+	}
+	if warning != "" {
+		result.Warnings = append(result.Warnings, warning)
+	}
+	args = append(args, codecArgs...)
+
+	// Metadatos del original
+	args = append(args, metadataArgs(videoInfo, opts)...)
+
+	// Configuración de audio
+	audioArgs := audioCodecArgs(videoInfo, duration, opts)
+
+	// Ejecuciones de ffmpeg necesarias
+	var runs []ffmpegRun
+
+	// Con -two-output la miniatura sale de la misma ejecución que el video. No se
+	// combina con dos pasadas, GIF ni codificación por hardware (cuadros en la GPU)
+	combined := opts.Thumbnail && opts.TwoOutput && !opts.TwoPass && !isGIF && !useHW
+	var plainRuns []ffmpegRun
+	var posterPath string
+
+	if opts.TwoPass {
+		// Directorio temporal propio para que los logs de cada video no se pisen
+		// entre trabajadores concurrentes
+		passDir, err := os.MkdirTemp("", "ffmpeg2pass-")
+		if err != nil {
+			return result, fmt.Errorf("error al crear directorio para los logs de dos pasadas: %w", err)
+		}
+		defer os.RemoveAll(passDir)
+		passLog := filepath.Join(passDir, "ffmpeg2pass")
+
+		// Primera pasada: solo análisis, sin audio ni archivo de salida
+		pass1 := append([]string{}, args...)
+		pass1 = append(pass1, opts.ExtraArgs...)
+		pass1 = append(pass1, "-pass", "1", "-passlogfile", passLog, "-an", "-f", "null", os.DevNull)
+		runs = append(runs, ffmpegRun{pass1, "error durante la primera pasada"})
+
+		// Segunda pasada: codificación final
+		pass2 := append([]string{}, args...)
+		pass2 = append(pass2, "-pass", "2", "-passlogfile", passLog)
+		pass2 = append(pass2, audioArgs...)
+		pass2 = append(pass2, opts.ExtraArgs...)
+		pass2 = append(pass2, outputFormatArgs(outputPath, encodePath, opts)...)
+		runs = append(runs, ffmpegRun{pass2, "error durante la segunda pasada"})
+	} else {
+		args = append(args, audioArgs...)
+		args = append(args, opts.ExtraArgs...)
+
+		// Archivo de salida
+		args = append(args, outputFormatArgs(outputPath, encodePath, opts)...)
+		runs = append(runs, ffmpegRun{args, "error durante la conversión"})
+
+		if combined {
+			thumbPath, posterArgs, err := posterOutputArgs(outputPath, videoFilter, duration, opts)
+			if err != nil {
+				return result, err
+			}
+			plainRuns = runs
+			runs = []ffmpegRun{{append(append([]string{}, args...), posterArgs...), "error durante la conversión"}}
+			posterPath = thumbPath
+			result.ThumbnailPath = thumbPath
+		}
+	}
+
+	for _, run := range runs {
+		result.Commands = append(result.Commands, formatCommand(opts.ffmpeg(), run.args))
+	}
+
+	if combined, err = runWithRetries(ctx, runs, plainRuns, posterPath, encodePath, duration, opts, &result); err != nil {
+		return result, err
+	}
+
+	// Miniatura a partir del video ya convertido, así refleja los filtros aplicados
+	if opts.Thumbnail && !combined {
+		thumbPath := thumbnailPath(outputPath, opts)
+		thumbArgs, err := thumbnailCommand(encodePath, thumbPath, duration, opts)
+		if err != nil {
+			return result, err
+		}
+		result.Commands = append(result.Commands, formatCommand(opts.ffmpeg(), thumbArgs))
+
+		thumbOpts := opts
+		thumbOpts.Progress = false
+		thumbOpts.ProgressJSON = nil
+		if err := runFFmpeg(ctx, thumbArgs, thumbOpts, 0); err != nil {
+			return result, encodeError(ctx, thumbPath, "error al generar la miniatura", err)
+		}
+		result.ThumbnailPath = thumbPath
+	}
+
+	// En modo simulación no hay archivo convertido que medir
+	if opts.DryRun {
+		result.Success = true
+		result.Elapsed = time.Since(start)
+		return result, nil
+	}
+
+	// Verificar tamaños para comparación
+	inputInfo, err := os.Stat(inputVideo)
+	if err != nil {
+		return result, fmt.Errorf("error al obtener tamaño del archivo original: %w", err)
+	}
+
+	outputInfo, err := os.Stat(encodePath)
+	if err != nil {
+		return result, fmt.Errorf("error al obtener tamaño del archivo convertido: %w", err)
+	}
+
+	result.InputSizeBytes = inputInfo.Size()
+	if opts.concat != nil {
+		result.InputSizeBytes = opts.concat.size
+	}
+	result.OutputSizeBytes = outputInfo.Size()
+
+	// Dimensiones reales de la salida, que con -resize/-scale pueden diferir de
+	// las pedidas por el ajuste de proporción y el redondeo a pares
+	outputVideoInfo, probeErr := probeVideo(ctx, opts.run(), opts.ffprobe(), encodePath)
+	if probeErr == nil {
+		result.Width = outputVideoInfo.Width
+		result.Height = outputVideoInfo.Height
+		result.OutputDuration = outputVideoInfo.Duration
+	}
+
+	// Un ffmpeg que termina bien no garantiza un archivo reproducible
+	if opts.Verify {
+		verifyErr := probeErr
+		if verifyErr == nil {
+			verifyErr = verifyOutput(outputVideoInfo, duration)
+		}
+		if verifyErr != nil {
+			result.VerifyError = verifyErr.Error()
+			// La miniatura de una salida inválida no sirve, se conserve o no la salida
+			if result.ThumbnailPath != "" {
+				os.Remove(result.ThumbnailPath)
+				result.ThumbnailPath = ""
+			}
+			// Sin -remove-invalid la salida se conserva para revisarla, pero con
+			// el nombre .part para que no pase por una conversión terminada
+			if !opts.RemoveInvalid && encodePath != outputPath {
+				keepPart = true
+				return result, fmt.Errorf("la salida no pasó la verificación (se conserva en '%s'): %w", encodePath, verifyErr)
+			}
+			return result, fmt.Errorf("la salida no pasó la verificación: %w", verifyErr)
+		}
+	}
+	if outputPath == StdioPath {
+		if err := copyToStdout(encodePath); err != nil {
+			return result, fmt.Errorf("error al escribir la salida en stdout: %w", err)
+		}
+	} else if encodePath != outputPath {
+		if err := moveFile(encodePath, outputPath); err != nil {
+			return result, fmt.Errorf("error al mover la salida a su destino: %w", err)
+		}
+	}
+	if result.InputSizeBytes > 0 {
+		result.Ratio = float64(result.OutputSizeBytes) / float64(result.InputSizeBytes) * 100
+	}
+	result.Success = true
+	result.Elapsed = time.Since(start)
+
+	if opts.DeleteSource {
+		if probeErr != nil {
+			probeErr = fmt.Errorf("ffprobe no pudo abrir la salida: %w", probeErr)
+		} else {
+			probeErr = checkDeletableOutput(result, outputVideoInfo, duration)
+		}
+		if probeErr != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("no se eliminó el original: %s", probeErr))
+		} else if err := os.Remove(inputVideo); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("no se pudo eliminar el original: %s", err))
+		} else {
+			result.SourceDeleted = true
+		}
+	}
+
+	return result, nil
+}
+
+// videoFilters arma los filtros de video en el orden en que ffmpeg debe
+// aplicarlos; duration es la duración de la salida, para los fundidos
+func videoFilters(inputVideo string, videoInfo *VideoInfo, duration float64, opts ConversionOptions) ([]string, error) {
+	var filters []string
+	isGIF := opts.OutputFormat == "gif"
+
+	// Desentrelazado antes que nada: girar, recortar o escalar mezclaría las
+	// líneas de los dos campos
+	deinterlace := opts.Deinterlace
+	if deinterlace == "" && opts.AutoDeinterlace && videoInfo.Interlaced() {
+		verbosef("Original entrelazado (%s): se aplica yadif\n", videoInfo.FieldOrder)
+		deinterlace = "frame"
+	}
+	if deinterlace != "" {
+		filters = append(filters, "yadif=mode="+yadifModes[deinterlace])
+	}
+
+	// HDR a SDR: se pasa a luz lineal, se comprime el rango con hable y se vuelve
+	// a bt709. Va antes del resto para que los filtros trabajen con colores SDR
+	if opts.Tonemap {
+		if videoInfo.HDR() {
+			verbosef("Original HDR (%s): se convierte a SDR\n", videoInfo.ColorTransfer)
+			filters = append(filters, tonemapFilter)
+		} else {
+			verbosef("El original no es HDR: -tonemap no se aplica\n")
+		}
+	}
+
+	// Rotación antes que cualquier otro filtro: las coordenadas de -crop y el
+	// tamaño de -resize se refieren al video ya derecho
+	rotation := opts.Rotate
+	if opts.Autorotate {
+		rotation += videoInfo.Rotation
+	}
+	filters = append(filters, rotationFilters(rotation)...)
+
+	// Al unir archivos de distinto tamaño cada uno se ajusta al del primero, con
+	// barras negras si la proporción no coincide. ffmpeg rearma los filtros cuando
+	// cambia la resolución, así que el mismo scale sirve para todos
+	if opts.concat != nil && opts.concat.width > 0 {
+		w, h := opts.concat.width, opts.concat.height
+		filters = append(filters,
+			fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease%s", w, h, scaleFlags(opts.ScaleAlgo)),
+			fmt.Sprintf("pad=%d:%d:(ow-iw)/2:(oh-ih)/2", w, h),
+			"setsar=1",
+		)
+	}
+
+	// Filtro de recorte
+	if opts.Crop != "" {
+		crop, err := parseCrop(opts.Crop)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, fmt.Sprintf("crop=%d:%d:%d:%d", crop.Width, crop.Height, crop.X, crop.Y))
+	}
+
+	// Reducción de ruido antes de escalar: el ruido grueso de grabaciones viejas se
+	// convierte en bloques parpadeantes al pixelar. hqdn3d deriva los demás
+	// parámetros a partir de la intensidad espacial de luma
+	if opts.Denoise > 0 {
+		filters = append(filters, "hqdn3d="+strconv.FormatFloat(opts.Denoise, 'f', -1, 64))
+	}
+
+	// Filtro de redimensionamiento. Al conservar la proporción el resultado puede
+	// quedar impar, y yuv420p solo admite medidas pares: el segundo scale recorta
+	// a lo sumo un píxel por lado
+	if opts.Resize != "" {
+		width, height, err := parseResize(opts.Resize)
+		if err != nil {
+			return nil, err
+		}
+		padWidth, padHeight := evenDimension(float64(width)), evenDimension(float64(height))
+		// Limitar el recuadro al tamaño de origen equivale a no escalar nunca por
+		// encima de 1, sin cambiar cómo se ajusta la proporción
+		if opts.NoUpscale {
+			srcWidth, srcHeight := filterInputSize(videoInfo, opts)
+			if srcWidth > 0 && srcHeight > 0 && (width > srcWidth || height > srcHeight) {
+				verbosef("-resize %s limitado a %dx%d para no agrandar el video\n", opts.Resize,
+					min(width, srcWidth), min(height, srcHeight))
+				width, height = min(width, srcWidth), min(height, srcHeight)
+			}
+		}
+		filters = append(filters,
+			fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease%s", width, height, scaleFlags(opts.ScaleAlgo)),
+			"scale=trunc(iw/2)*2:trunc(ih/2)*2"+scaleFlags(opts.ScaleAlgo),
+		)
+		// Bandas centradas hasta el tamaño pedido (redondeado a pares), para que
+		// todas las salidas de un lote midan lo mismo sin importar su orientación
+		if opts.Pad {
+			color := cmp.Or(opts.PadColor, "black")
+			filters = append(filters, fmt.Sprintf("pad=%d:%d:(ow-iw)/2:(oh-ih)/2:color=%s", padWidth, padHeight, color))
+		}
+	}
+
+	// Escalado por porcentaje sobre el tamaño que llega a este punto (ya girado y recortado)
+	if opts.Scale > 0 {
+		width, height := filterInputSize(videoInfo, opts)
+		filters = append(filters, fmt.Sprintf("scale=%d:%d%s",
+			evenDimension(float64(width)*opts.Scale/100),
+			evenDimension(float64(height)*opts.Scale/100),
+			scaleFlags(opts.ScaleAlgo)))
+	}
+
+	// Enfoque sobre la resolución final, antes del pixelado para no remarcar
+	// los bordes de los bloques
+	if opts.Sharpen > 0 {
+		filters = append(filters, "unsharp=5:5:"+strconv.FormatFloat(opts.Sharpen, 'f', -1, 64))
+	}
+
+	// Blanco y negro o duotono antes del pixelado y la paleta, para que los
+	// bloques y los colores reducidos salgan de la imagen ya virada
+	if opts.Grayscale {
+		filters = append(filters, "hue=s=0")
+	}
+	if opts.Duotone != "" {
+		shadows, highlights, err := parseDuotone(opts.Duotone)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, "hue=s=0", duotoneCurves(shadows, highlights))
+	}
+
+	// Efecto pixel art: reducir y volver a ampliar con vecino más cercano para
+	// mantener bordes duros. Se aplica sobre la resolución final (después de -resize)
+	// y la reducción se redondea a pares para que el resultado siga siendo par.
+	// -scale-algo reemplaza al vecino más cercano si se pide otra interpolación
+	if opts.PixelateFactor > 0 {
+		f := opts.PixelateFactor
+		flags := scaleFlags(cmp.Or(opts.ScaleAlgo, "neighbor"))
+		filters = append(filters,
+			fmt.Sprintf("scale=trunc(iw/%d)*2:trunc(ih/%d)*2%s", 2*f, 2*f, flags),
+			fmt.Sprintf("scale=iw*%d:ih*%d%s", f, f, flags),
+		)
+	}
+
+	// Subtítulos sobre la imagen ya terminada, para que el pixelado y el escalado
+	// no los vuelvan ilegibles. Con -start la entrada empieza en 0, así que se
+	// corren las marcas de tiempo para que el filtro muestre los textos correctos
+	if opts.Subtitles != "" {
+		subtitlesFilter, err := subtitlesFilter(opts, videoInfo, inputVideo)
+		if err != nil {
+			return nil, err
+		}
+		if start, _ := parseTimestamp(opts.StartTime); start > 0 {
+			offset := strconv.FormatFloat(start, 'f', -1, 64)
+			filters = append(filters, "setpts=PTS+"+offset+"/TB", subtitlesFilter, "setpts=PTS-STARTPTS")
+		} else {
+			filters = append(filters, subtitlesFilter)
+		}
+	}
+
+	// Cambio de velocidad después de los subtítulos, que usan los tiempos del
+	// original, y antes de -fps, que así descarta los cuadros sobrantes del timelapse
+	if changesSpeed(opts) {
+		filters = append(filters, "setpts=PTS/"+strconv.FormatFloat(opts.Speed, 'f', -1, 64))
+	}
+
+	// Filtro de tasa de cuadros, siempre después del escalado
+	// (solo cambia la cantidad de cuadros, no la duración)
+	if opts.FPS > 0 {
+		filters = append(filters, "fps="+strconv.FormatFloat(opts.FPS, 'f', -1, 64))
+	}
+
+	// Boomerang: una copia del flujo se invierte y se concatena al original. Va
+	// después del escalado para que reverse guarde en memoria cuadros más chicos
+	if opts.Boomerang {
+		filters = append(filters, "split[fwd][bwd];[bwd]reverse[rev];[fwd][rev]concat=n=2:v=1:a=0")
+	}
+
+	// Marca de agua sobre los cuadros ya escalados para que no se pixele ni cambie
+	// de tamaño con el video
+	if opts.Watermark != "" {
+		watermark, err := watermarkFilter(opts)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, watermark)
+	}
+
+	// Fundidos sobre la línea de tiempo de la salida: después de los recortes,
+	// -speed y -boomerang, que cambian dónde termina el video
+	filters = append(filters, fadeFilters("fade", opts.FadeIn, opts.FadeOut, duration)...)
+
+	// Filtros propios del usuario, después de los generados pero antes de la
+	// paleta, que necesita los cuadros definitivos
+	if opts.Filters != "" {
+		filters = append(filters, opts.Filters)
+	}
+
+	// Reducción de paleta para un aspecto retro. palettegen necesita su propia rama,
+	// así que se divide el flujo: una copia genera la paleta y la otra la aplica.
+	// stats_mode=single calcula una paleta por cuadro para no tener que leer todo
+	// el video antes de empezar a codificar. En GIF la paleta ya forma parte del formato
+	if opts.PaletteColors > 0 && !isGIF {
+		filters = append(filters, fmt.Sprintf(
+			"split[a][b];[a]palettegen=max_colors=%d:stats_mode=single[p];[b][p]paletteuse=new=1%s",
+			opts.PaletteColors, ditherOption(opts.Dither, ":"),
+		))
+	}
+
+	// GIF admite como máximo 256 colores: se genera una paleta para todo el clip
+	// a partir de los cuadros ya filtrados (tamaño y fps incluidos)
+	if isGIF {
+		colors := 256
+		if opts.PaletteColors > 0 {
+			colors = opts.PaletteColors
+		}
+		filters = append(filters, fmt.Sprintf(
+			"split[s0][s1];[s0]palettegen=max_colors=%d[p];[s1][p]paletteuse%s",
+			colors, ditherOption(opts.Dither, "="),
+		))
+	}
+
+	return filters, nil
+}
+
+// encoderArgs devuelve los argumentos del encoder de video: códec, control de
+// bitrate, keyframes e hilos. Si tuvo que suponer la tasa de cuadros devuelve
+// además una advertencia
+func encoderArgs(videoInfo *VideoInfo, bitrate int, hwAccel hwAccelSpec, useHW bool, opts ConversionOptions) ([]string, string, error) {
+	var args []string
+	var warning string
+	if opts.OutputFormat == "gif" {
+		// Repetir la animación indefinidamente
+		args = append(args, "-loop", "0")
+	} else if useHW {
+		codecArgs, err := hardwareCodecArgs(hwAccel, opts, bitrate)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, codecArgs...)
+	} else {
+		codecArgs, err := videoCodecArgs(opts, bitrate)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, codecArgs...)
+	}
+
+	// VBR restringido: limita los picos de bitrate para reproducir en conexiones lentas
+	if opts.MaxRate != "" {
+		maxRate, _ := parseBitrate(opts.MaxRate)
+		bufSize := 2 * maxRate
+		if opts.BufSize != "" {
+			bufSize, _ = parseBitrate(opts.BufSize)
+		}
+		args = append(args, "-maxrate", fmt.Sprintf("%dk", maxRate), "-bufsize", fmt.Sprintf("%dk", bufSize))
+	}
+
+	// Keyframes regulares para saltar dentro del video y para streaming adaptativo
+	if opts.KeyInt != "" {
+		keyInt, _ := parseKeyInt(opts.KeyInt)
+		if keyInt == 0 {
+			// Con -fps la tasa de salida es la indicada, no la del original
+			fps := opts.FPS
+			if fps <= 0 {
+				// -speed acelera o frena los cuadros sin descartar ninguno
+				fps = videoInfo.FPS * cmp.Or(opts.Speed, 1)
+			}
+			if fps <= 0 {
+				fps = 25
+				warning = "no se pudo determinar la tasa de cuadros; -keyint auto supone 25 fps"
+			}
+			keyInt = int(math.Round(fps * autoKeyIntSeconds))
+		}
+		args = append(args, "-g", strconv.Itoa(keyInt), "-keyint_min", strconv.Itoa(keyInt))
+	}
+
+	// Configurar número de hilos
+	if opts.Threads > 0 {
+		args = append(args, "-threads", strconv.Itoa(opts.Threads))
+	}
+
+	return args, warning, nil
+}
+
+// metadataArgs vuelve a aplicar los metadatos del original o los descarta todos.
+// Cada par va en un único argumento, así que espacios y comillas no necesitan
+// escape. GIF no admite metadatos, así que no se copian
+func metadataArgs(videoInfo *VideoInfo, opts ConversionOptions) []string {
+	if opts.StripMetadata {
+		return []string{"-map_metadata", "-1"}
+	}
+	if opts.OutputFormat == "gif" {
+		return nil
+	}
+	keys := make([]string, 0, len(videoInfo.Tags))
+	for key := range videoInfo.Tags {
+		if !ignoredMetadataTags[strings.ToLower(key)] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var args []string
+	for _, key := range keys {
+		args = append(args, "-metadata", key+"="+videoInfo.Tags[key])
+	}
+	return args
+}
+
+// audioCodecArgs devuelve los argumentos de la pista de audio, con sus filtros,
+// o -an si la salida no lleva audio
+func audioCodecArgs(videoInfo *VideoInfo, duration float64, opts ConversionOptions) []string {
+	if opts.NoAudio || opts.OutputFormat == "gif" || opts.Boomerang || (opts.LoopTo != "" && !opts.LoopAudio) {
+		return []string{"-an"}
+	}
+	if !videoInfo.HasAudio {
+		return nil
+	}
+	audioEncoder := "libopus"
+	if opts.OutputFormat == "mp4" {
+		audioEncoder = "aac"
+	} else if opts.AudioCodec != "" {
+		audioEncoder = audioCodecs[strings.ToLower(opts.AudioCodec)]
+	}
+	audioBitrate := "96k"
+	if opts.AudioBitrate != "" {
+		audioBitrate = opts.AudioBitrate
+	}
+	audioArgs := []string{
+		"-c:a", audioEncoder,
+		"-b:a", audioBitrate,
+	}
+
+	var audioFilters []string
+	if changesSpeed(opts) {
+		audioFilters = append(audioFilters, atempoFilters(opts.Speed)...)
+	}
+
+	// Nivelar la sonoridad para que los clips de un lote suenen parejos
+	if opts.NormalizeAudio {
+		target := -16.0
+		if opts.LoudnessTarget != 0 {
+			target = opts.LoudnessTarget
+		}
+		audioFilters = append(audioFilters,
+			fmt.Sprintf("loudnorm=I=%s:TP=-1.5:LRA=11", strconv.FormatFloat(target, 'f', -1, 64)))
+	}
+
+	// Después de loudnorm, que si no subiría el volumen de los tramos en fundido
+	audioFilters = append(audioFilters, fadeFilters("afade", opts.FadeIn, opts.FadeOut, duration)...)
+	if len(audioFilters) > 0 {
+		audioArgs = append(audioArgs, "-af", strings.Join(audioFilters, ","))
+	}
+	return audioArgs
+}
+
+// ffmpegRun es una ejecución de ffmpeg, con el mensaje a usar si falla
+type ffmpegRun struct {
+	args    []string
+	message string
+}
+
+// runWithRetries ejecuta runs en orden. ffmpeg a veces falla por errores
+// transitorios de E/S en equipos cargados: si termina con un código distinto de
+// cero se reintenta con una espera creciente, borrando antes la salida parcial.
+// Si runs genera video y miniatura juntos, fallback son las ejecuciones por
+// separado; devuelve si la miniatura salió de la ejecución combinada
+func runWithRetries(ctx context.Context, runs, fallback []ffmpegRun, posterPath, encodePath string, duration float64, opts ConversionOptions, result *ConversionResult) (bool, error) {
+	combined := fallback != nil
+	for attempt := 1; ; attempt++ {
+		result.Attempts = attempt
+
+		var runErr error
+		var message string
+		for _, run := range runs {
+			if runErr = runFFmpeg(ctx, run.args, opts, duration); runErr != nil {
+				message = run.message
+				break
+			}
+		}
+		if runErr == nil {
+			break
+		}
+
+		// Si falla la ejecución con dos salidas, video y miniatura van por separado
+		if combined && ctx.Err() == nil {
+			combined = false
+			runs = fallback
+			os.Remove(posterPath)
+			result.ThumbnailPath = ""
+			result.Warnings = append(result.Warnings, fmt.Sprintf(
+				"falló la ejecución con video y miniatura juntos (%s); se generan por separado", runErr))
+			for _, run := range runs {
+				result.Commands = append(result.Commands, formatCommand(opts.ffmpeg(), run.args))
+			}
+			// Pasar a ejecuciones separadas no consume uno de los -retries
+			attempt--
+			continue
+		}
+
+		var exitErr *exec.ExitError
+		if ctx.Err() != nil || !errors.As(runErr, &exitErr) || attempt > opts.Retries {
+			if attempt > 1 {
+				message = fmt.Sprintf("%s (intento %d)", message, attempt)
+			}
+			return false, encodeError(ctx, encodePath, message, runErr)
+		}
+		os.Remove(encodePath)
+
+		backoff := retryBackoff << (attempt - 1)
+		result.Warnings = append(result.Warnings, fmt.Sprintf(
+			"intento %d fallido (%s: %s); reintentando en %s", attempt, message, runErr, backoff))
+		select {
+		case <-ctx.Done():
+			return false, encodeError(ctx, encodePath, message, runErr)
+		case <-time.After(backoff):
+		}
+	}
+	return combined, nil
+}
+
+// Límites por debajo de los cuales una salida se considera sospechosa y el
+// original no se elimina con -delete-source
+const (
+	minDeletableOutputBytes = 4 * 1024
+	minDeletableOutputRatio = 1.0 // Porcentaje del tamaño original
+)
+
+// checkDeletableOutput decide si la salida de una conversión es confiable como
+// para eliminar el original: ante la duda devuelve un error y el original se conserva
+func checkDeletableOutput(result ConversionResult, info *VideoInfo, expectedDuration float64) error {
+	switch {
+	case result.OutputSizeBytes < minDeletableOutputBytes:
+		return fmt.Errorf("la salida ocupa solo %d bytes", result.OutputSizeBytes)
+	case result.Ratio < minDeletableOutputRatio:
+		return fmt.Errorf("la salida ocupa solo el %.2f%% del original", result.Ratio)
+	}
+	return verifyOutput(info, expectedDuration)
+}
+
+// Diferencia de duración admitida entre la salida y lo esperado: un segundo o
+// el 2% de la duración, lo que sea mayor
+const (
+	verifyMinTolerance = 1.0
+	verifyTolerance    = 0.02
+)
+
+// verifyOutput comprueba que la salida tenga una pista de video y que su
+// duración se acerque a la esperada (0 si no se conoce)
+func verifyOutput(info *VideoInfo, expectedDuration float64) error {
+	if info.Width <= 0 || info.Height <= 0 {
+		return errors.New("la salida no tiene una pista de video válida")
+	}
+	if info.Duration <= 0 {
+		return errors.New("no se pudo determinar la duración de la salida")
+	}
+	if expectedDuration > 0 {
+		tolerance := max(verifyMinTolerance, expectedDuration*verifyTolerance)
+		if math.Abs(info.Duration-expectedDuration) > tolerance {
+			return fmt.Errorf("la salida dura %.2f segundos y se esperaban %.2f", info.Duration, expectedDuration)
+		}
+	}
+	return nil
+}
+
+// thumbnailPath devuelve la ruta de la miniatura de un video: el mismo nombre
+// con la extensión del formato de imagen
+func thumbnailPath(videoPath string, opts ConversionOptions) string {
+	format := opts.ThumbnailFormat
+	if format == "" {
+		format = "jpg"
+	}
+	return strings.TrimSuffix(videoPath, filepath.Ext(videoPath)) + "." + format
+}
+
+// thumbnailCommand arma los argumentos de ffmpeg para extraer de videoPath la
+// miniatura thumbPath
+func thumbnailCommand(videoPath, thumbPath string, duration float64, opts ConversionOptions) ([]string, error) {
+	offset, err := thumbnailOffset(opts.ThumbnailTime, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"-y", "-v", "error",
+		"-ss", strconv.FormatFloat(offset, 'f', 3, 64),
+		"-i", videoPath,
+		"-frames:v", "1",
+	}
+	if filepath.Ext(thumbPath) == ".jpg" {
+		args = append(args, "-q:v", "2")
+	}
+	args = append(args, thumbPath)
+
+	return args, nil
+}
+
+// posterOutputArgs arma la segunda salida de -two-output: la miniatura se toma de
+// los mismos cuadros decodificados, con los filtros del video (-ss como opción de
+// salida descarta los cuadros anteriores sin buscar en el original)
+func posterOutputArgs(outputPath, videoFilter string, duration float64, opts ConversionOptions) (string, []string, error) {
+	offset, err := thumbnailOffset(opts.ThumbnailTime, duration)
+	if err != nil {
+		return "", nil, err
+	}
+	thumbPath := thumbnailPath(outputPath, opts)
+
+	var args []string
+	if videoFilter != "" {
+		args = append(args, "-vf", videoFilter)
+	}
+	args = append(args, "-ss", strconv.FormatFloat(offset, 'f', 3, 64), "-frames:v", "1")
+	if filepath.Ext(thumbPath) == ".jpg" {
+		args = append(args, "-q:v", "2")
+	}
+	args = append(args, "-an", thumbPath)
+
+	return thumbPath, args, nil
+}
+
+// PrintResult muestra el resultado de una conversión: el plan en modo simulación
+// o el tamaño del archivo convertido respecto del original
+func PrintResult(result ConversionResult, opts ConversionOptions) {
+	if result.Skipped {
+		Infof("Omitiendo %s - %s\n", filepath.Base(result.InputPath), cmp.Or(result.SkipReason, "ya procesado"))
+		return
+	}
+
+	for _, warning := range result.Warnings {
+		Infof("Aviso: %s\n", warning)
+	}
+
+	if opts.DryRun {
+		for _, command := range result.Commands {
+			Infof("%s\n", command)
+		}
+		Infof("Salida: %s\n", result.OutputPath)
+		return
+	}
+
+	if opts.TwoPass {
+		Infof("Dos pasadas completadas en %.2f segundos\n", result.Elapsed.Seconds())
+	}
+
+	outputSize := float64(result.OutputSizeBytes) / (1024 * 1024) // MB
+	Infof("✓ %s - %.2f MB (%.1f%% del original)\n", filepath.Base(result.OutputPath), outputSize, result.Ratio)
+	if result.Width > 0 && (opts.Resize != "" || opts.Scale > 0) {
+		Infof("  Resolución: %dx%d\n", result.Width, result.Height)
+	}
+	if result.TrimmedDuration > 0 {
+		Infof("  Segmento: %.2f segundos\n", result.TrimmedDuration)
+	}
+	if result.ThumbnailPath != "" {
+		Infof("  Miniatura: %s\n", filepath.Base(result.ThumbnailPath))
+	}
+	if result.SourceDeleted {
+		Infof("  Original eliminado: %s\n", filepath.Base(result.InputPath))
+	}
+}
+
+// subtitlesFilter arma el filtro subtitles para -subtitles, ya sea con un archivo
+// externo o con una pista incrustada en el original
+func subtitlesFilter(opts ConversionOptions, info *VideoInfo, inputVideo string) (string, error) {
+	path, index, err := parseSubtitles(opts.Subtitles)
+	if err != nil {
+		return "", err
+	}
+	if index >= 0 {
+		if index >= info.SubtitleStreams {
+			return "", fmt.Errorf("el video tiene %d pistas de subtítulos; no existe la pista %d", info.SubtitleStreams, index)
+		}
+		return fmt.Sprintf("subtitles=filename=%s:si=%d", escapeFilterPath(inputVideo), index), nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("no se pudo leer el archivo de subtítulos: %w", err)
+	}
+	return "subtitles=filename=" + escapeFilterPath(path), nil
+}
+
+// watermarkFilter superpone la imagen de -watermark. El filtro movie la carga
+// dentro del mismo -vf, así que no hace falta una segunda entrada ni
+// -filter_complex y sigue funcionando con dos pasadas y -two-output
+func watermarkFilter(opts ConversionOptions) (string, error) {
+	if _, err := os.Stat(opts.Watermark); err != nil {
+		return "", fmt.Errorf("no se pudo leer la marca de agua: %w", err)
+	}
+	position := watermarkPositions[cmp.Or(strings.ToLower(opts.WatermarkPos), "bottomright")]
+
+	source := "movie=filename=" + escapeFilterPath(opts.Watermark)
+	if opacity := cmp.Or(opts.WatermarkOpacity, 1); opacity < 1 {
+		source += ",format=rgba,colorchannelmixer=aa=" + strconv.FormatFloat(opacity, 'f', -1, 64)
+	}
+	return fmt.Sprintf("null[base];%s[wm];[base][wm]overlay=%s", source, position), nil
+}
+
+// videoCodecArgs arma los argumentos de codificación de video según el formato,
+// el códec elegido y el modo de control de calidad
+func videoCodecArgs(opts ConversionOptions, bitrate int) ([]string, error) {
+	preset, err := lookupPreset(opts.Preset)
+	if err != nil {
+		return nil, err
+	}
+
+	// MP4 usa H.264 para máxima compatibilidad
+	if opts.OutputFormat == "mp4" {
+		args := []string{"-c:v", "libx264"}
+		if opts.CRF >= 0 {
+			args = append(args, "-crf", strconv.Itoa(opts.CRF))
+		} else {
+			args = append(args, "-b:v", fmt.Sprintf("%dk", bitrate))
+		}
+		// faststart mueve el índice al comienzo para poder reproducir mientras se descarga
+		args = append(args, "-preset", preset.X264, "-pix_fmt", "yuv420p", "-movflags", "+faststart")
+		return args, nil
+	}
+
+	spec, err := lookupCodec(opts.Codec)
+	if err != nil {
+		return nil, err
+	}
+	encoder := spec.Encoder
+	if encoder == "libaom-av1" && hasEncoder(opts, "libsvtav1") {
+		// SVT-AV1 es mucho más rápido que libaom cuando está disponible
+		encoder = "libsvtav1"
+	}
+	args := []string{"-c:v", encoder}
+
+	// Modo de calidad constante (CRF) o bitrate objetivo
+	if opts.CRF >= 0 {
+		args = append(args, "-crf", strconv.Itoa(opts.CRF))
+		if encoder == "libvpx" {
+			// VP8 usa el bitrate como límite superior en modo CRF
+			args = append(args, "-b:v", fmt.Sprintf("%dk", bitrate))
+		} else {
+			args = append(args, "-b:v", "0")
+		}
+	} else {
+		args = append(args, "-b:v", fmt.Sprintf("%dk", bitrate))
+	}
+
+	// Velocidad de codificación según el preset
+	switch encoder {
+	case "libvpx", "libvpx-vp9":
+		args = append(args, "-deadline", preset.Deadline, "-cpu-used", strconv.Itoa(preset.CPUUsed))
+	case "libaom-av1":
+		args = append(args, "-cpu-used", strconv.Itoa(preset.CPUUsed))
+	case "libsvtav1":
+		args = append(args, "-preset", strconv.Itoa(preset.SVT))
+	}
+
+	// Sin -row-mt ni columnas de tiles VP9 casi no aprovecha más de un par de hilos
+	if encoder == "libvpx-vp9" && opts.Threads > 1 {
+		if opts.RowMT {
+			args = append(args, "-row-mt", "1")
+		}
+		args = append(args, "-tile-columns", strconv.Itoa(tileColumns(opts.Threads)))
+	}
+
+	if encoder == "libvpx-vp9" {
+		if opts.LagInFrames >= 0 {
+			args = append(args, "-lag-in-frames", strconv.Itoa(opts.LagInFrames))
+		}
+		if opts.AutoAltRef >= 0 {
+			args = append(args, "-auto-alt-ref", strconv.Itoa(opts.AutoAltRef))
+		}
+		if opts.ArnrMaxFrames >= 0 {
+			args = append(args, "-arnr-maxframes", strconv.Itoa(opts.ArnrMaxFrames))
+		}
+	}
+
+	pixFmt := "yuv420p"
+	if opts.Alpha && encoder == "libvpx-vp9" {
+		pixFmt = "yuva420p"
+	}
+	args = append(args, "-pix_fmt", pixFmt)
+
+	return args, nil
+}
+
+// hardwareCodecArgs arma los argumentos de H.264 para un encoder por hardware
+func hardwareCodecArgs(hw hwAccelSpec, opts ConversionOptions, bitrate int) ([]string, error) {
+	preset, err := lookupPreset(opts.Preset)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"-c:v", hw.Encoder}
+	if opts.CRF >= 0 {
+		args = append(args, hw.QualityFlag, strconv.Itoa(opts.CRF))
+	} else {
+		args = append(args, "-b:v", fmt.Sprintf("%dk", bitrate))
+	}
+
+	// VAAPI no tiene presets de velocidad
+	switch hw.Encoder {
+	case "h264_nvenc":
+		args = append(args, "-preset", preset.NVENC)
+	case "h264_qsv":
+		args = append(args, "-preset", preset.QSV)
+	}
+
+	if hw.PixFmt != "" {
+		args = append(args, "-pix_fmt", hw.PixFmt)
+	}
+	args = append(args, "-movflags", "+faststart")
+
+	return args, nil
+}
+
+// formatCommand arma una línea de comando legible, con comillas en los argumentos con espacios
+func formatCommand(name string, args []string) string {
+	parts := []string{name}
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\"'") {
+			arg = strconv.Quote(arg)
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+// runFFmpeg ejecuta ffmpeg con los argumentos indicados (no hace nada en modo simulación).
+// duration se usa para calcular el porcentaje de la barra de progreso
+func runFFmpeg(ctx context.Context, args []string, opts ConversionOptions, duration float64) error {
+	if opts.DryRun {
+		return nil
+	}
+
+	verbosef("Comando: %s\n", formatCommand(opts.ffmpeg(), args))
+
+	showProgress := opts.Progress && !opts.Verbose
+	if showProgress {
+		// -stats mantiene el reporte de progreso aunque se use -v warning
+		args = append([]string{"-stats"}, args...)
+	}
+
+	// Con -json-progress ffmpeg informa su avance como clave=valor en stdout
+	var stdout io.Writer
+	if opts.ProgressJSON != nil {
+		args = append([]string{"-progress", "pipe:1"}, args...)
+		pass := 0
+		if i := slices.Index(args, "-pass"); i >= 0 && i+1 < len(args) {
+			pass, _ = strconv.Atoi(args[i+1])
+		}
+		stdout = &progressReporter{
+			out:   opts.ProgressJSON,
+			event: ProgressEvent{Input: opts.progressInput, Pass: pass, Duration: duration},
+		}
+	}
+
+	// stderr se guarda siempre para poder explicar por qué falló ffmpeg
+	var stderrBuf bytes.Buffer
+	runner := opts.run()
+	if opts.Verbose {
+		if stdout == nil {
+			stdout = logOutput
+		}
+		err := runner.Run(ctx, opts.ffmpeg(), args, stdout, io.MultiWriter(os.Stderr, &stderrBuf))
+		return stderrError(err, stderrBuf.Bytes())
+	}
+	if !showProgress {
+		return stderrError(runner.Run(ctx, opts.ffmpeg(), args, stdout, &stderrBuf), stderrBuf.Bytes())
+	}
+
+	stderr, stderrWriter := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := runner.Run(ctx, opts.ffmpeg(), args, stdout, stderrWriter)
+		stderrWriter.Close()
+		done <- err
+	}()
+
+	// ffmpeg actualiza el progreso con \r, así que se separa por ambos finales de línea
+	scanner := bufio.NewScanner(stderr)
+	scanner.Split(scanLinesOrCR)
+	for scanner.Scan() {
+		if m := progressTimeRe.FindStringSubmatch(scanner.Text()); m != nil {
+			hours, _ := strconv.Atoi(m[1])
+			minutes, _ := strconv.Atoi(m[2])
+			seconds, _ := strconv.ParseFloat(m[3], 64)
+			renderProgress(float64(hours*3600+minutes*60)+seconds, duration)
+		} else {
+			stderrBuf.WriteString(scanner.Text() + "\n")
+		}
+	}
+	io.Copy(&stderrBuf, stderr)
+	Infof("\n")
+
+	return stderrError(<-done, stderrBuf.Bytes())
+}
+
+// maxStderrLines es la cantidad de líneas finales de stderr que se agregan al
+// error cuando ffmpeg falla
+const maxStderrLines = 8
+
+// stderrError agrega al error las últimas líneas que ffmpeg escribió en stderr
+// (sin las de progreso), que suelen explicar la causa real de la falla
+func stderrError(err error, stderr []byte) error {
+	if err == nil {
+		return nil
+	}
+
+	var lines []string
+	for _, line := range strings.FieldsFunc(string(stderr), func(r rune) bool { return r == '\n' || r == '\r' }) {
+		line = strings.TrimSpace(line)
+		if line != "" && !progressTimeRe.MatchString(line) {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return err
+	}
+	if len(lines) > maxStderrLines {
+		lines = lines[len(lines)-maxStderrLines:]
+	}
+	return fmt.Errorf("%w\n  %s", err, strings.Join(lines, "\n  "))
+}
+
+// tempOutputPath devuelve el archivo .part en el que ffmpeg escribe una salida:
+// outputPath + ".part" o, con tmpDir, un nombre único dentro de ese directorio
+// (los trabajadores pueden convertir videos con el mismo nombre a la vez)
+func tempOutputPath(outputPath, tmpDir string) (string, error) {
+	pattern := filepath.Base(outputPath) + ".*.part"
+	if outputPath == StdioPath {
+		// La salida por stdout se arma completa antes de copiarla
+		pattern = "pyxelart-stdout-*.part"
+	} else if tmpDir == "" {
+		return outputPath + ".part", nil
+	}
+	file, err := os.CreateTemp(tmpDir, pattern)
+	if err != nil {
+		return "", fmt.Errorf("error al crear el archivo temporal de salida: %w", err)
+	}
+	file.Close()
+	return file.Name(), nil
+}
+
+// outputMuxers indica el formato de ffmpeg según la extensión de la salida.
+// Hace falta porque ffmpeg no puede deducirlo del nombre .part
+var outputMuxers = map[string]string{
+	".webm": "webm",
+	".mp4":  "mp4",
+	".m4v":  "mp4",
+	".mov":  "mov",
+	".mkv":  "matroska",
+	".gif":  "gif",
+}
+
+// outputFormatArgs devuelve los argumentos finales de ffmpeg para escribir
+// outputPath en encodePath: el archivo y, si es un .part, el formato explícito
+func outputFormatArgs(outputPath, encodePath string, opts ConversionOptions) []string {
+	if encodePath == outputPath {
+		return []string{encodePath}
+	}
+	muxer, ok := outputMuxers[strings.ToLower(filepath.Ext(outputPath))]
+	if !ok {
+		muxer = strings.TrimPrefix(outputExtension(opts), ".")
+	}
+	return []string{"-f", muxer, encodePath}
+}
+
+// StdioPath como entrada lee el video de stdin y como salida lo escribe en stdout
+const StdioPath = "-"
+
+// bufferStdin copia stdin a un archivo temporal en tmpDir (vacío = el directorio
+// temporal del sistema) y devuelve su ruta
+func bufferStdin(tmpDir string) (string, error) {
+	file, err := os.CreateTemp(tmpDir, "pyxelart-stdin-*")
+	if err != nil {
+		return "", fmt.Errorf("error al crear el archivo temporal para stdin: %w", err)
+	}
+	if _, err := io.Copy(file, os.Stdin); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", fmt.Errorf("error al leer el video de stdin: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("error al leer el video de stdin: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// copyToStdout escribe el archivo path completo en stdout
+func copyToStdout(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(os.Stdout, file)
+	return err
+}
+
+// moveFile renombra src a dst. Si están en discos distintos copia primero a un
+// temporal junto a dst y lo renombra, para que dst aparezca completo de una vez
+func moveFile(src, dst string) error {
+	// Solo un cambio de disco justifica copiar; cualquier otro error (permisos,
+	// un directorio que no existe) se informa tal cual
+	if err := os.Rename(src, dst); err == nil || !crossDevice(err) {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(out.Name(), dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// encodeError arma el error de una ejecución fallida de ffmpeg. Si la causa fue
+// una cancelación o el tiempo límite, elimina el archivo parcial que quedó a medias
+func encodeError(ctx context.Context, outputPath, message string, err error) error {
+	ctxErr := ctx.Err()
+	if ctxErr == nil {
+		return classify(ErrEncodeFailed, fmt.Errorf("%s: %w", message, err))
+	}
+
+	os.Remove(outputPath)
+	if errors.Is(ctxErr, context.DeadlineExceeded) {
+		return classify(ErrEncodeFailed, fmt.Errorf("%s: tiempo límite excedido: %w", message, ctxErr))
+	}
+	return classify(ErrEncodeFailed, fmt.Errorf("%s: conversión cancelada: %w", message, ctxErr))
+}
+
+// ffmpegWaitDelay es cuánto se espera a que se cierren las salidas de un ffmpeg cancelado
+const ffmpegWaitDelay = 3 * time.Second
+
+// progressTimeRe extrae la posición actual de las líneas de estado de ffmpeg
+var progressTimeRe = regexp.MustCompile(`time=(\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+
+// scanLinesOrCR es una función de división para bufio.Scanner que corta en \r o \n
+func scanLinesOrCR(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// renderProgress dibuja la barra de progreso sobre una misma línea. Si la duración
+// es desconocida solo muestra el tiempo procesado
+func renderProgress(current, total float64) {
+	const width = 30
+
+	if total <= 0 {
+		Infof("\r  Procesado: %.1f s", current)
+		return
+	}
+
+	fraction := current / total
+	if fraction > 1 {
+		fraction = 1
+	}
+	filled := int(fraction * width)
+	Infof("\r  [%s%s] %5.1f%%", strings.Repeat("█", filled), strings.Repeat("░", width-filled), fraction*100)
+}
@@ -0,0 +1,564 @@
+package pyxelart
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestConvertArgsDefault(t *testing.T) {
+	args := convertArgs(t, &mockRunner{}, DefaultOptions())
+
+	for flag, want := range map[string]string{
+		"-c:v": "libvpx-vp9",
+		"-b:v": "500k",
+		"-c:a": "libopus",
+		"-b:a": "96k",
+	} {
+		if got, _ := argValue(args, flag); got != want {
+			t.Errorf("%s = %q, se esperaba %q (args: %v)", flag, got, want, args)
+		}
+	}
+	if slices.Contains(args, "-vf") {
+		t.Errorf("no se esperaban filtros de video: %v", args)
+	}
+	// ffmpeg escribe en un .part junto a la salida que después se renombra
+	if format, _ := argValue(args, "-f"); format != "webm" || filepath.Base(args[len(args)-1]) != "clip.webm.part" {
+		t.Errorf("la salida .part debe ser el último argumento: %v", args)
+	}
+}
+
+func TestConvertArgsCrop(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Crop = "10:20:640:360"
+	args := convertArgs(t, &mockRunner{}, opts)
+
+	if got, _ := argValue(args, "-vf"); got != "crop=640:360:10:20" {
+		t.Errorf("-vf = %q, se esperaba crop=640:360:10:20", got)
+	}
+}
+
+func TestConvertArgsResize(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Resize = "1280x720"
+	args := convertArgs(t, &mockRunner{}, opts)
+
+	want := "scale=1280:720:force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2"
+	if got, _ := argValue(args, "-vf"); got != want {
+		t.Errorf("-vf = %q, se esperaba %q", got, want)
+	}
+}
+
+func TestConvertArgsQualityTiers(t *testing.T) {
+	tests := []struct {
+		quality int
+		bitrate string
+	}{
+		{0, "100k"},
+		{10, "233k"},
+		{30, "500k"},
+		{50, "1250k"},
+		{70, "2000k"},
+		{90, "4666k"},
+		{100, "6000k"},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.Quality = tt.quality
+		args := convertArgs(t, &mockRunner{}, opts)
+		if got, _ := argValue(args, "-b:v"); got != tt.bitrate {
+			t.Errorf("calidad %d: -b:v = %q, se esperaba %q", tt.quality, got, tt.bitrate)
+		}
+	}
+}
+
+func TestConvertArgsBitrate(t *testing.T) {
+	for bitrate, want := range map[string]string{"1800": "1800k", "1500k": "1500k", "2M": "2000k"} {
+		opts := DefaultOptions()
+		opts.Quality = 90
+		opts.Bitrate = bitrate
+		args := convertArgs(t, &mockRunner{}, opts)
+
+		if got, _ := argValue(args, "-b:v"); got != want {
+			t.Errorf("-bitrate %s: -b:v = %q, se esperaba %q sin importar la calidad", bitrate, got, want)
+		}
+	}
+}
+
+func TestConvertArgsCRF(t *testing.T) {
+	opts := DefaultOptions()
+	opts.CRF = 30
+	args := convertArgs(t, &mockRunner{}, opts)
+
+	if got, _ := argValue(args, "-crf"); got != "30" {
+		t.Errorf("-crf = %q, se esperaba 30", got)
+	}
+	if got, _ := argValue(args, "-b:v"); got != "0" {
+		t.Errorf("-b:v = %q, se esperaba 0 con CRF", got)
+	}
+}
+
+func TestConvertArgsAudio(t *testing.T) {
+	t.Run("con NoAudio", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.NoAudio = true
+		args := convertArgs(t, &mockRunner{}, opts)
+		if !slices.Contains(args, "-an") || slices.Contains(args, "-c:a") {
+			t.Errorf("se esperaba -an sin códec de audio: %v", args)
+		}
+	})
+
+	t.Run("original sin audio", func(t *testing.T) {
+		args := convertArgs(t, &mockRunner{noAudio: true}, DefaultOptions())
+		if slices.Contains(args, "-c:a") {
+			t.Errorf("no se esperaba códec de audio: %v", args)
+		}
+	})
+
+	t.Run("vorbis", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.AudioCodec = "vorbis"
+		opts.AudioBitrate = "128k"
+		args := convertArgs(t, &mockRunner{}, opts)
+		if got, _ := argValue(args, "-c:a"); got != "libvorbis" {
+			t.Errorf("-c:a = %q, se esperaba libvorbis", got)
+		}
+		if got, _ := argValue(args, "-b:a"); got != "128k" {
+			t.Errorf("-b:a = %q, se esperaba 128k", got)
+		}
+	})
+}
+
+func TestConvertDryRunSkipsRunner(t *testing.T) {
+	runner := &mockRunner{}
+	opts := DefaultOptions()
+	opts.DryRun = true
+	result, err := convertClip(t, runner, opts)
+	if err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	if len(runner.runCalls) != 0 {
+		t.Errorf("en simulación no se debe ejecutar ffmpeg: %v", runner.runCalls)
+	}
+	if len(result.Commands) != 1 {
+		t.Errorf("se esperaba un comando en el resultado, hubo %d", len(result.Commands))
+	}
+}
+
+func TestConvertArgsNoUpscale(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Resize = "3840x1600"
+	args := convertArgs(t, &mockRunner{}, opts)
+
+	want := "scale=1920:1080:force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2"
+	if got, _ := argValue(args, "-vf"); got != want {
+		t.Errorf("-vf = %q, se esperaba %q", got, want)
+	}
+
+	opts.NoUpscale = false
+	args = convertArgs(t, &mockRunner{}, opts)
+	want = "scale=3840:1600:force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2"
+	if got, _ := argValue(args, "-vf"); got != want {
+		t.Errorf("sin NoUpscale: -vf = %q, se esperaba %q", got, want)
+	}
+}
+
+func TestConvertArgsSubtitles(t *testing.T) {
+	dir := t.TempDir()
+	srt := filepath.Join(dir, "it's [final], v2.srt")
+	if err := os.WriteFile(srt, []byte("1\n00:00:01,000 --> 00:00:02,000\nHola\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultOptions()
+	opts.Subtitles = srt
+	args := convertArgs(t, &mockRunner{}, opts)
+	want := "subtitles=filename=" + escapeFilterPath(srt)
+	if got, _ := argValue(args, "-vf"); got != want {
+		t.Errorf("-vf = %q, se esperaba %q", got, want)
+	}
+
+	opts.Subtitles = "embedded:1"
+	opts.StartTime = "5"
+	args = convertArgs(t, &mockRunner{subtitles: 2}, opts)
+	got, _ := argValue(args, "-vf")
+	if !strings.HasPrefix(got, "setpts=PTS+5/TB,subtitles=filename=") || !strings.HasSuffix(got, ":si=1,setpts=PTS-STARTPTS") {
+		t.Errorf("-vf = %q, se esperaba la pista 1 con las marcas de tiempo corridas 5 segundos", got)
+	}
+}
+
+func TestConvertSubtitlesMissingStream(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Subtitles = "embedded:0"
+	if _, err := convertClip(t, &mockRunner{}, opts); err == nil {
+		t.Error("se esperaba un error para un video sin pistas de subtítulos")
+	}
+}
+
+func TestConvertArgsLoopTo(t *testing.T) {
+	opts := DefaultOptions()
+	opts.LoopTo = "60"
+	args := convertArgs(t, &mockRunner{}, opts)
+
+	// El original de prueba dura 10 segundos: 5 repeticiones extra
+	if got, _ := argValue(args, "-stream_loop"); got != "5" {
+		t.Errorf("-stream_loop = %q, se esperaba 5", got)
+	}
+	if i, j := slices.Index(args, "-stream_loop"), slices.Index(args, "-i"); i > j {
+		t.Errorf("-stream_loop debe ir antes de -i: %v", args)
+	}
+	if got, _ := argValue(args, "-t"); got != "60" {
+		t.Errorf("-t = %q, se esperaba 60", got)
+	}
+	if !slices.Contains(args, "-c:a") {
+		t.Errorf("con LoopAudio se esperaba conservar el audio: %v", args)
+	}
+
+	opts.LoopTo = "4"
+	opts.LoopAudio = false
+	args = convertArgs(t, &mockRunner{}, opts)
+	if slices.Contains(args, "-stream_loop") || !slices.Contains(args, "-an") {
+		t.Errorf("un original más largo solo se corta, sin audio: %v", args)
+	}
+	if got, _ := argValue(args, "-t"); got != "4" {
+		t.Errorf("-t = %q, se esperaba 4", got)
+	}
+}
+
+func TestConvertArgsDeinterlace(t *testing.T) {
+	opts := DefaultOptions()
+	opts.AutoDeinterlace = true
+	opts.Resize = "640x360"
+	args := convertArgs(t, &mockRunner{fieldOrder: "progressive"}, opts)
+	if got, _ := argValue(args, "-vf"); strings.Contains(got, "yadif") {
+		t.Errorf("un original progresivo no se desentrelaza: -vf = %q", got)
+	}
+
+	args = convertArgs(t, &mockRunner{fieldOrder: "tt"}, opts)
+	if got, _ := argValue(args, "-vf"); !strings.HasPrefix(got, "yadif=mode=send_frame,scale=") {
+		t.Errorf("-vf = %q, se esperaba yadif antes del escalado", got)
+	}
+
+	opts.AutoDeinterlace = false
+	opts.Deinterlace = "field"
+	args = convertArgs(t, &mockRunner{}, opts)
+	if got, _ := argValue(args, "-vf"); !strings.HasPrefix(got, "yadif=mode=send_field,") {
+		t.Errorf("-vf = %q, se esperaba yadif en modo field", got)
+	}
+}
+
+func TestConvertArgsPad(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Resize = "1080x1920"
+	opts.Pad = true
+	opts.PadColor = "#202020"
+	args := convertArgs(t, &mockRunner{}, opts)
+
+	got, _ := argValue(args, "-vf")
+	if !strings.HasSuffix(got, ",pad=1080:1920:(ow-iw)/2:(oh-ih)/2:color=#202020") {
+		t.Errorf("-vf = %q, se esperaban bandas hasta 1080x1920", got)
+	}
+}
+
+func TestConvertArgsDuotone(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Duotone = "#000000,#ff8000"
+	opts.PixelateFactor = 4
+	args := convertArgs(t, &mockRunner{}, opts)
+
+	got, _ := argValue(args, "-vf")
+	want := "hue=s=0,curves=r='0/0.000 1/1.000':g='0/0.000 1/0.502':b='0/0.000 1/0.000',scale=trunc(iw/8)*2"
+	if !strings.HasPrefix(got, want) {
+		t.Errorf("-vf = %q, se esperaba el duotono antes del pixelado", got)
+	}
+}
+
+func TestConvertArgsDither(t *testing.T) {
+	opts := DefaultOptions()
+	opts.PaletteColors = 8
+	opts.Dither = "none"
+	args := convertArgs(t, &mockRunner{}, opts)
+	if got, _ := argValue(args, "-vf"); !strings.HasSuffix(got, "paletteuse=new=1:dither=none") {
+		t.Errorf("-vf = %q, se esperaba paletteuse sin tramado", got)
+	}
+
+	opts = DefaultOptions()
+	opts.OutputFormat = "gif"
+	opts.Dither = "bayer"
+	args = convertArgs(t, &mockRunner{}, opts)
+	if got, _ := argValue(args, "-vf"); !strings.HasSuffix(got, "[s1][p]paletteuse=dither=bayer") {
+		t.Errorf("-vf = %q, se esperaba el tramado bayer en el GIF", got)
+	}
+}
+
+func TestConvertArgsScaleAlgo(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Resize = "640x360"
+	opts.PixelateFactor = 4
+	opts.ScaleAlgo = "lanczos"
+	args := convertArgs(t, &mockRunner{}, opts)
+
+	got, _ := argValue(args, "-vf")
+	for _, filter := range strings.Split(got, ",") {
+		if strings.HasPrefix(filter, "scale=") && !strings.HasSuffix(filter, ":flags=lanczos") {
+			t.Errorf("%q no usa la interpolación pedida (-vf = %q)", filter, got)
+		}
+	}
+
+	opts.ScaleAlgo = ""
+	args = convertArgs(t, &mockRunner{}, opts)
+	if got, _ := argValue(args, "-vf"); !strings.HasSuffix(got, "scale=iw*4:ih*4:flags=neighbor") {
+		t.Errorf("-vf = %q, el pixelado debería seguir usando neighbor por defecto", got)
+	}
+}
+
+func TestConvertMinFree(t *testing.T) {
+	if _, err := freeSpace(t.TempDir()); err != nil {
+		t.Skipf("no se puede consultar el espacio libre: %v", err)
+	}
+
+	runner := &mockRunner{}
+	opts := DefaultOptions()
+	opts.MinFree = 1 << 62
+	if _, err := convertClip(t, runner, opts); !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("err = %v, se esperaba ErrNoSpace", err)
+	}
+	if len(runner.runCalls) != 0 {
+		t.Errorf("sin espacio no debería ejecutarse ffmpeg (%d ejecuciones)", len(runner.runCalls))
+	}
+}
+
+func TestConvertTmpDir(t *testing.T) {
+	dir := t.TempDir()
+	tmpDir := t.TempDir()
+	input := writeClip(t, dir, "clip.mp4")
+	output := filepath.Join(dir, "out", "clip.webm")
+
+	runner := &mockRunner{}
+	opts := DefaultOptions()
+	opts.TmpDir = tmpDir
+	converter := Converter{Options: opts, Runner: runner}
+	if _, err := converter.Convert(context.Background(), input, output); err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+
+	args := runner.runCalls[0]
+	if got := filepath.Dir(args[len(args)-1]); got != tmpDir {
+		t.Errorf("ffmpeg escribió en %q, se esperaba -tmp-dir %q", got, tmpDir)
+	}
+	if info, err := os.Stat(output); err != nil || info.Size() != 1024 {
+		t.Errorf("la salida no se movió a su destino: %v", err)
+	}
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+		t.Errorf("quedaron archivos temporales: %v", entries)
+	}
+}
+
+func TestConvertVerifyFailureKeepsPart(t *testing.T) {
+	dir := t.TempDir()
+	input := writeClip(t, dir, "clip.mp4")
+	output := filepath.Join(dir, "clip.webm")
+
+	// El mock informa 10 segundos para la salida y con -loop-to se esperan 60
+	opts := DefaultOptions()
+	opts.LoopTo = "60"
+	opts.Verify = true
+	opts.Thumbnail = true
+	converter := Converter{Options: opts, Runner: &mockRunner{}}
+	result, err := converter.Convert(context.Background(), input, output)
+	if err == nil {
+		t.Fatal("se esperaba un error de verificación")
+	}
+	thumb := thumbnailPath(output, opts)
+	if _, err := os.Stat(thumb); !os.IsNotExist(err) || result.ThumbnailPath != "" {
+		t.Errorf("la miniatura de una salida inválida no debe quedar (%s, ThumbnailPath = %q)", thumb, result.ThumbnailPath)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("una salida que no pasó la verificación no debe quedar en %s", output)
+	}
+	if _, err := os.Stat(output + ".part"); err != nil {
+		t.Errorf("sin -remove-invalid la salida debería conservarse como .part: %v", err)
+	}
+
+	converter.Options.RemoveInvalid = true
+	if _, err := converter.Convert(context.Background(), input, output); err == nil {
+		t.Fatal("se esperaba un error de verificación")
+	}
+	if _, err := os.Stat(output + ".part"); !os.IsNotExist(err) {
+		t.Errorf("con -remove-invalid el .part debería eliminarse")
+	}
+}
+
+func TestConvertStdio(t *testing.T) {
+	dir := t.TempDir()
+	input := writeClip(t, dir, "clip.mp4")
+	stdin, err := os.Open(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+
+	savedStdin, savedStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdin, stdout
+	defer func() { os.Stdin, os.Stdout = savedStdin, savedStdout }()
+
+	runner := &mockRunner{}
+	opts := DefaultOptions()
+	opts.TmpDir = dir
+	converter := Converter{Options: opts, Runner: runner}
+	if _, err := converter.Convert(context.Background(), StdioPath, StdioPath); err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+
+	args := runner.runCalls[0]
+	if in, _ := argValue(args, "-i"); in == StdioPath || !strings.HasPrefix(filepath.Base(in), "pyxelart-stdin-") {
+		t.Errorf("ffmpeg debería leer la copia de stdin, leyó %q", in)
+	}
+	if info, err := stdout.Stat(); err != nil || info.Size() != 1024 {
+		t.Errorf("la salida no se escribió en stdout: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("quedaron archivos temporales: %v", entries)
+	}
+}
+
+func TestConvertArgsTonemap(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Tonemap = true
+	opts.Resize = "640x360"
+	args := convertArgs(t, &mockRunner{transfer: "smpte2084"}, opts)
+	if got, _ := argValue(args, "-vf"); !strings.HasPrefix(got, tonemapFilter+",scale=") {
+		t.Errorf("-vf = %q, se esperaba el tonemapping antes del escalado", got)
+	}
+
+	args = convertArgs(t, &mockRunner{transfer: "bt709"}, opts)
+	if got, _ := argValue(args, "-vf"); strings.Contains(got, "tonemap") {
+		t.Errorf("un original SDR no necesita tonemapping: -vf = %q", got)
+	}
+}
+
+func TestConvertDurationLimits(t *testing.T) {
+	// El mock informa 10 segundos
+	stats := &ConversionStats{}
+	for _, tc := range []struct {
+		min, max string
+		skipped  bool
+	}{
+		{"", "5", true},
+		{"0:20", "", true},
+		{"5", "1:00", false},
+	} {
+		runner := &mockRunner{}
+		opts := DefaultOptions()
+		opts.MinDuration, opts.MaxDuration = tc.min, tc.max
+		result, err := convertClip(t, runner, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.SkippedByDuration != tc.skipped || (tc.skipped && (len(runner.runCalls) > 0 || result.SkipReason == "")) {
+			t.Errorf("min %q, max %q: omitido = %v (%q), %d llamadas a ffmpeg",
+				tc.min, tc.max, result.SkippedByDuration, result.SkipReason, len(runner.runCalls))
+		}
+		stats.agregarResultado(result)
+	}
+	// Los omitidos se cuentan aparte, no como conversiones exitosas
+	if stats.SkippedByDuration != 2 || stats.Exito != 1 || stats.Error != 0 {
+		t.Errorf("SkippedByDuration = %d, Exito = %d, Error = %d; se esperaba 2, 1, 0",
+			stats.SkippedByDuration, stats.Exito, stats.Error)
+	}
+}
+
+func TestConvertArgsSpeed(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Speed = 4
+	opts.NormalizeAudio = true
+	args := convertArgs(t, &mockRunner{}, opts)
+	if got, _ := argValue(args, "-vf"); got != "setpts=PTS/4" {
+		t.Errorf("-vf = %q", got)
+	}
+	if got, _ := argValue(args, "-af"); !strings.HasPrefix(got, "atempo=2,atempo=2,loudnorm=") {
+		t.Errorf("-af = %q, se esperaba atempo encadenado antes de loudnorm", got)
+	}
+}
+
+func TestConvertArgsFades(t *testing.T) {
+	// El mock informa 10 segundos: el segmento 2-8 acelerado al doble dura 3
+	opts := DefaultOptions()
+	opts.StartTime, opts.EndTime = "2", "8"
+	opts.Speed = 2
+	opts.FadeIn, opts.FadeOut = 0.5, 1
+	args := convertArgs(t, &mockRunner{}, opts)
+	if got, _ := argValue(args, "-vf"); got != "setpts=PTS/2,fade=t=in:st=0:d=0.5,fade=t=out:st=2.000:d=1" {
+		t.Errorf("-vf = %q", got)
+	}
+	if got, _ := argValue(args, "-af"); got != "atempo=2,afade=t=in:st=0:d=0.5,afade=t=out:st=2.000:d=1" {
+		t.Errorf("-af = %q", got)
+	}
+
+	opts = DefaultOptions()
+	opts.Sample = 2
+	opts.FadeIn, opts.FadeOut = 1, 1.5
+	if _, err := convertClip(t, &mockRunner{}, opts); err == nil {
+		t.Error("se esperaba un error con fundidos más largos que la salida")
+	}
+}
+
+func TestConvertArgsWatermark(t *testing.T) {
+	logo := filepath.Join(t.TempDir(), "logo.png")
+	if err := os.WriteFile(logo, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions()
+	opts.Watermark = logo
+	opts.WatermarkPos = "topright"
+	opts.WatermarkOpacity = 0.5
+	opts.FadeIn = 1
+	args := convertArgs(t, &mockRunner{}, opts)
+	want := "null[base];movie=filename=" + escapeFilterPath(logo) +
+		",format=rgba,colorchannelmixer=aa=0.5[wm];[base][wm]overlay=W-w-10:10,fade=t=in:st=0:d=1"
+	if got, _ := argValue(args, "-vf"); got != want {
+		t.Errorf("-vf = %q\nse esperaba %q", got, want)
+	}
+}
+
+func TestMoveFileMissingDir(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "clip.webm.part")
+	if err := os.WriteFile(src, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Un error que no es de cambio de disco no debe terminar en una copia
+	if err := moveFile(src, filepath.Join(dir, "no-existe", "clip.webm")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("moveFile = %v, se esperaba os.ErrNotExist", err)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("el original no debería moverse: %v", err)
+	}
+}
+
+func TestConvertTwoOutputFallbackAttempts(t *testing.T) {
+	// Falla la ejecución con video y miniatura juntos; sin reintentos, las
+	// ejecuciones por separado siguen siendo el primer intento
+	runner := &mockRunner{failRuns: 1}
+	opts := DefaultOptions()
+	opts.Thumbnail = true
+	opts.TwoOutput = true
+	opts.Retries = 0
+	result, err := convertClip(t, runner, opts)
+	if err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	if result.Attempts != 1 || len(runner.runCalls) != 3 {
+		t.Errorf("Attempts = %d, %d ejecuciones de ffmpeg; se esperaba 1 intento y 3 ejecuciones",
+			result.Attempts, len(runner.runCalls))
+	}
+}
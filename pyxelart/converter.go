@@ -0,0 +1,110 @@
+package pyxelart
+
+import "context"
+
+// Converter agrupa las opciones de conversión y los binarios a usar, para
+// convertir sin depender de FFmpegBin/FFprobeBin. Options conviene inicializarlo
+// con DefaultOptions, ya que su valor cero no es una configuración válida
+type Converter struct {
+	Options     ConversionOptions
+	Directory   DirectoryOptions // Opciones de ConvertDir
+	FFmpegPath  string           // Vacío usa FFmpegBin
+	FFprobePath string           // Vacío usa FFprobeBin
+	Runner      CommandRunner    // nil ejecuta los comandos con ExecRunner
+}
+
+// DefaultOptions devuelve los valores por defecto de la línea de comandos, sin
+// barra de progreso
+func DefaultOptions() ConversionOptions {
+	return ConversionOptions{
+		Quality:         30,
+		CRF:             -1,
+		Codec:           "vp9",
+		Preset:          "balanced",
+		OutputFormat:    "webm",
+		AudioCodec:      "opus",
+		AudioBitrate:    "96k",
+		LoudnessTarget:  -16,
+		ThumbnailTime:   "10%",
+		ThumbnailFormat: "jpg",
+		LagInFrames:     -1,
+		AutoAltRef:      -1,
+		ArnrMaxFrames:   -1,
+		RowMT:           true,
+		NoUpscale:       true,
+		LoopAudio:       true,
+	}
+}
+
+// options devuelve las opciones con los binarios y el CommandRunner del Converter
+func (c *Converter) options() ConversionOptions {
+	opts := c.Options
+	opts.ffmpegPath = c.FFmpegPath
+	opts.ffprobePath = c.FFprobePath
+	opts.runner = c.Runner
+	return opts
+}
+
+// Convert convierte input en output (vacío = junto al original con la extensión
+// del formato elegido)
+func (c *Converter) Convert(ctx context.Context, input, output string) (ConversionResult, error) {
+	opts := c.options()
+	if err := ValidateOptions(opts); err != nil {
+		return ConversionResult{InputPath: input}, err
+	}
+	return ConvertVideo(ctx, input, output, opts)
+}
+
+// ConvertDir convierte los videos de dir en out (vacío = un subdirectorio de dir
+// con el nombre del formato) según c.Directory
+func (c *Converter) ConvertDir(ctx context.Context, dir, out string) (*ConversionStats, error) {
+	opts := c.options()
+	if err := ValidateOptions(opts); err != nil {
+		return nil, err
+	}
+	return ProcessDirectory(ctx, dir, out, opts, c.Directory)
+}
+
+// EstimateDir predice el tamaño de convertir los videos de dir a out según
+// c.Directory, sin ejecutar ffmpeg (ver EstimateDirectory)
+func (c *Converter) EstimateDir(ctx context.Context, dir, out string) (*SizeEstimate, error) {
+	opts := c.options()
+	if err := ValidateOptions(opts); err != nil {
+		return nil, err
+	}
+	return EstimateDirectory(ctx, dir, out, opts, c.Directory)
+}
+
+// ConvertChapters convierte cada capítulo de input en un archivo propio dentro de
+// outDir (vacío = junto al original)
+func (c *Converter) ConvertChapters(ctx context.Context, input, outDir string) ([]ConversionResult, error) {
+	opts := c.options()
+	if err := ValidateOptions(opts); err != nil {
+		return nil, err
+	}
+	return ConvertChapters(ctx, input, outDir, opts)
+}
+
+// Concat une inputs, en orden, en un único video (ver ConcatVideos)
+func (c *Converter) Concat(ctx context.Context, inputs []string, output string) (ConversionResult, error) {
+	opts := c.options()
+	if err := ValidateOptions(opts); err != nil {
+		return ConversionResult{}, err
+	}
+	return ConcatVideos(ctx, inputs, output, opts)
+}
+
+// Bench mide input con cada combinación de preset e hilos (ver Benchmark)
+func (c *Converter) Bench(ctx context.Context, input string, cases []BenchCase) ([]BenchResult, error) {
+	opts := c.options()
+	if err := ValidateOptions(opts); err != nil {
+		return nil, err
+	}
+	return Benchmark(ctx, input, opts, cases)
+}
+
+// Info obtiene la información de un video con el ffprobe del Converter
+func (c *Converter) Info(ctx context.Context, path string) (*VideoInfo, error) {
+	opts := c.options()
+	return probeVideo(ctx, opts.run(), opts.ffprobe(), path)
+}
@@ -0,0 +1,15 @@
+//go:build openbsd
+
+package pyxelart
+
+import "syscall"
+
+// freeSpace devuelve los bytes disponibles para el usuario en el sistema de
+// archivos que contiene path (en OpenBSD los campos de Statfs_t llevan el prefijo F_)
+func freeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.F_bavail) * uint64(stat.F_bsize), nil
+}
@@ -0,0 +1,11 @@
+//go:build unix && !linux && !darwin && !freebsd && !dragonfly && !aix && !openbsd
+
+package pyxelart
+
+import "errors"
+
+// freeSpace no está implementado en esta plataforma (NetBSD, Solaris): la
+// verificación de espacio libre se omite
+func freeSpace(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,18 @@
+//go:build !unix && !windows
+
+package pyxelart
+
+import "errors"
+
+// freeSpace no está implementado en esta plataforma: la verificación de
+// espacio libre se omite
+func freeSpace(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
+
+// crossDevice no puede distinguir el error de un cambio de disco (plan9 ni
+// siquiera renombra entre directorios), así que cualquier falla de os.Rename
+// pasa a la copia
+func crossDevice(err error) bool {
+	return true
+}
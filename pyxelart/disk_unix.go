@@ -0,0 +1,13 @@
+//go:build unix
+
+package pyxelart
+
+import (
+	"errors"
+	"syscall"
+)
+
+// crossDevice indica si err es el de un os.Rename entre sistemas de archivos distintos
+func crossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
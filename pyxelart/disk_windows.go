@@ -0,0 +1,35 @@
+//go:build windows
+
+package pyxelart
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+// errorNotSameDevice es ERROR_NOT_SAME_DEVICE: Windows no usa EXDEV al mover
+// un archivo a otro volumen
+const errorNotSameDevice = syscall.Errno(17)
+
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// freeSpace devuelve los bytes disponibles para el usuario en el volumen que
+// contiene path
+func freeSpace(path string) (uint64, error) {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var available uint64
+	ok, _, err := getDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(pathPtr)), uintptr(unsafe.Pointer(&available)), 0, 0)
+	if ok == 0 {
+		return 0, err
+	}
+	return available, nil
+}
+
+// crossDevice indica si err es el de un os.Rename entre volúmenes distintos
+func crossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
@@ -0,0 +1,34 @@
+package pyxelart
+
+import (
+	"errors"
+)
+
+// Errores centinela para distinguir con errors.Is por qué falló una conversión.
+// Los errores devueltos conservan además su causa (exec.ExitError,
+// context.DeadlineExceeded, ...)
+var (
+	ErrInputNotFound = errors.New("el archivo de entrada no existe")
+	ErrProbeFailed   = errors.New("ffprobe no pudo analizar el video")
+	ErrEncodeFailed  = errors.New("ffmpeg no pudo convertir el video")
+	ErrNoSpace       = errors.New("no hay espacio suficiente en el disco")
+)
+
+// classifiedError asocia un error a uno de los errores centinela sin cambiar su mensaje
+type classifiedError struct {
+	kind error
+	err  error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// classify marca err como un caso de kind para errors.Is
+func classify(kind, err error) error {
+	return &classifiedError{kind: kind, err: err}
+}
@@ -0,0 +1,154 @@
+package pyxelart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// FileEstimate es el tamaño previsto para la salida de un video
+type FileEstimate struct {
+	InputPath  string  `json:"input"`
+	InputBytes int64   `json:"input_bytes"`
+	Duration   float64 `json:"duration_seconds"` // Duración de la salida (con -start/-end, -sample, etc.)
+	VideoKbps  int     `json:"video_kbps"`
+	AudioKbps  int     `json:"audio_kbps"`
+	Bytes      int64   `json:"estimated_bytes"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// SizeEstimate es la previsión de un lote completo
+type SizeEstimate struct {
+	Files           []FileEstimate `json:"files"`
+	Found           int            `json:"found"` // Videos encontrados, antes de -limit
+	TotalBytes      int64          `json:"total_estimated_bytes"`
+	TotalInputBytes int64          `json:"total_input_bytes"`
+}
+
+// outputDuration calcula cuánto durará la salida de un original de duration
+// segundos con los recortes y repeticiones de opts, igual que ConvertVideo
+func outputDuration(duration float64, opts ConversionOptions) float64 {
+	if opts.StartTime != "" || opts.EndTime != "" {
+		start, _ := parseTimestamp(opts.StartTime)
+		end, _ := parseTimestamp(opts.EndTime)
+		if end > 0 && (duration == 0 || end < duration) {
+			duration = end
+		}
+		duration = max(0, duration-start)
+	}
+	if opts.Sample > 0 && (duration == 0 || opts.Sample < duration) {
+		duration = opts.Sample
+	}
+	if opts.LoopTo != "" {
+		duration, _ = parseTimestamp(opts.LoopTo)
+	}
+	if opts.Boomerang {
+		duration *= 2
+	}
+	if changesSpeed(opts) {
+		duration /= opts.Speed
+	}
+	return duration
+}
+
+// estimateVideo predice el tamaño de la salida de un video a partir de su
+// duración y del bitrate que usaría la conversión. Con -crf el bitrate de la
+// calidad es solo una referencia: el tamaño real depende del contenido
+func estimateVideo(ctx context.Context, path string, opts ConversionOptions) FileEstimate {
+	estimate := FileEstimate{InputPath: path}
+	if info, err := os.Stat(path); err == nil {
+		estimate.InputBytes = info.Size()
+	}
+
+	videoInfo, err := probeVideo(ctx, opts.run(), opts.ffprobe(), path)
+	if err != nil {
+		estimate.Error = fmt.Sprintf("error al obtener información del video: %s", err)
+		return estimate
+	}
+	estimate.Duration = outputDuration(videoInfo.Duration, opts)
+	if estimate.Duration <= 0 {
+		estimate.Error = "ffprobe no informó la duración del video"
+		return estimate
+	}
+
+	if videoInfo.HasAudio && !opts.NoAudio && !opts.Boomerang {
+		estimate.AudioKbps = audioBitrateKbps(opts.AudioBitrate)
+	}
+	if opts.TargetSize > 0 {
+		estimate.VideoKbps, _, _ = targetBitrate(opts.TargetSize, estimate.Duration, estimate.AudioKbps)
+		estimate.Bytes = opts.TargetSize
+		return estimate
+	}
+
+	estimate.VideoKbps = qualityToBitrate(opts.Quality)
+	if opts.Bitrate != "" {
+		estimate.VideoKbps, _ = parseBitrate(opts.Bitrate)
+	}
+	estimate.Bytes = estimatedBytes(estimate.VideoKbps, estimate.AudioKbps, estimate.Duration)
+	return estimate
+}
+
+// estimatedBytes calcula el tamaño de duration segundos de video y audio a esos
+// bitrates, con el margen del contenedor
+func estimatedBytes(videoKbps, audioKbps int, duration float64) int64 {
+	return int64(float64(videoKbps+audioKbps) * 1000 / 8 * duration * (1 + targetSizeOverhead))
+}
+
+// checkFreeSpace verifica que en el disco de dir entren expected bytes y que
+// después sigan libres al menos minFree. Si la plataforma no permite consultar
+// el espacio libre la verificación se omite
+func checkFreeSpace(dir string, expected, minFree int64) error {
+	free, err := freeSpace(dir)
+	if err != nil {
+		verbosef("No se pudo consultar el espacio libre en '%s': %s\n", dir, err)
+		return nil
+	}
+	needed := expected + minFree
+	if free < uint64(needed) {
+		return classify(ErrNoSpace, fmt.Errorf("espacio insuficiente en '%s': quedan %.2f MB y se necesitan unos %.2f MB (%.2f MB de salida estimada + %.2f MB de -min-free)",
+			dir, float64(free)/(1024*1024), float64(needed)/(1024*1024), float64(expected)/(1024*1024), float64(minFree)/(1024*1024)))
+	}
+	return nil
+}
+
+// EstimateDirectory predice el tamaño total de convertir los videos de inputDir
+// sin ejecutar ffmpeg: solo analiza la duración de cada original con ffprobe.
+// Estima los mismos videos que convertiría ProcessDirectory, con -sort, -shuffle
+// y -limit incluidos
+func EstimateDirectory(ctx context.Context, inputDir, outputDir string, opts ConversionOptions, dirOpts DirectoryOptions) (*SizeEstimate, error) {
+	if opts.OutputFormat == "gif" {
+		return nil, errors.New("no se puede estimar el tamaño de un GIF: no usa un bitrate fijo")
+	}
+	if _, err := os.Stat(inputDir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("el directorio '%s' no existe", inputDir)
+	}
+
+	if outputDir == "" {
+		outputDir = defaultOutputDir(inputDir, opts)
+	}
+	found, _, err := findVideos(inputDir, outputDir, dirOpts)
+	if err != nil {
+		return nil, err
+	}
+	outputFiles, err := planOutputs(ctx, found, inputDir, outputDir, opts, dirOpts, make(map[string]string))
+	if err != nil {
+		return nil, err
+	}
+	videos, _, err := selectWork(found, outputFiles, opts, dirOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SizeEstimate{Files: make([]FileEstimate, 0, len(videos)), Found: len(found)}
+	for _, video := range videos {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		estimate := estimateVideo(ctx, video, opts)
+		result.Files = append(result.Files, estimate)
+		result.TotalBytes += estimate.Bytes
+		result.TotalInputBytes += estimate.InputBytes
+	}
+	return result, nil
+}
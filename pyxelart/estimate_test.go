@@ -0,0 +1,73 @@
+package pyxelart
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestEstimateDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.mp4", "b.mov"} {
+		writeClip(t, dir, name)
+	}
+
+	runner := &mockRunner{}
+	opts := DefaultOptions()
+	opts.Bitrate = "1M"
+	opts.StartTime = "4"
+	converter := Converter{Options: opts, Runner: runner}
+	estimate, err := converter.EstimateDir(context.Background(), dir, "")
+	if err != nil {
+		t.Fatalf("EstimateDir: %v", err)
+	}
+	if len(runner.runCalls) != 0 {
+		t.Errorf("-estimate no debería ejecutar ffmpeg (%d ejecuciones)", len(runner.runCalls))
+	}
+	if len(estimate.Files) != 2 || estimate.Found != 2 || estimate.TotalInputBytes != 8192 {
+		t.Fatalf("estimate = %+v", estimate)
+	}
+
+	// 6 segundos (10 - 4) a 1000 + 96 kbps, más el margen del contenedor
+	file := estimate.Files[0]
+	if file.Duration != 6 || file.VideoKbps != 1000 || file.AudioKbps != 96 || file.Bytes != 838440 {
+		t.Errorf("estimación de %s = %+v", file.InputPath, file)
+	}
+	if estimate.TotalBytes != 2*file.Bytes {
+		t.Errorf("TotalBytes = %d, se esperaba %d", estimate.TotalBytes, 2*file.Bytes)
+	}
+}
+
+func TestEstimateDirLimit(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"c.mp4", "a.mp4", "b.mp4"} {
+		writeClip(t, dir, name)
+	}
+	// Una salida de una corrida anterior en el -output indicado no se estima
+	out := filepath.Join(dir, "convertidos")
+	if err := os.Mkdir(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeClip(t, out, "a.mp4")
+
+	opts := DefaultOptions()
+	opts.JSON = true
+	converter := Converter{
+		Options:   opts,
+		Runner:    &mockRunner{},
+		Directory: DirectoryOptions{Recursive: true, Sort: "name", Limit: 2},
+	}
+	estimate, err := converter.EstimateDir(context.Background(), dir, out)
+	if err != nil {
+		t.Fatalf("EstimateDir: %v", err)
+	}
+	var names []string
+	for _, file := range estimate.Files {
+		names = append(names, filepath.Base(file.InputPath))
+	}
+	if estimate.Found != 3 || !slices.Equal(names, []string{"a.mp4", "b.mp4"}) {
+		t.Errorf("Found = %d, estimados = %v; se esperaban los 2 primeros de 3", estimate.Found, names)
+	}
+}
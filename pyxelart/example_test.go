@@ -0,0 +1,39 @@
+package pyxelart_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/elanticrypt0/pyxelart/pyxelart"
+)
+
+func ExampleConverter() {
+	opts := pyxelart.DefaultOptions()
+	opts.Quality = 60
+	opts.Thumbnail = true
+
+	converter := pyxelart.Converter{
+		Options:    opts,
+		FFmpegPath: "/usr/local/bin/ffmpeg",
+	}
+
+	result, err := converter.Convert(context.Background(), "clip.mp4", "clip.webm")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s: %d -> %d bytes\n", result.OutputPath, result.InputSizeBytes, result.OutputSizeBytes)
+}
+
+func ExampleConverter_ConvertDir() {
+	converter := pyxelart.Converter{
+		Options:   pyxelart.DefaultOptions(),
+		Directory: pyxelart.DirectoryOptions{Recursive: true, MaxWorkers: 2},
+	}
+
+	stats, err := converter.ConvertDir(context.Background(), "videos", "videos/webm")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%d convertidos, %d con error\n", stats.Exito, stats.Error)
+}
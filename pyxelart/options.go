@@ -0,0 +1,1034 @@
+package pyxelart
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// codecSpec describe un códec de video soportado
+type codecSpec struct {
+	Encoder string
+	MinCRF  int
+	MaxCRF  int
+}
+
+// videoCodecs contiene los códecs de video soportados y su rango de CRF
+var videoCodecs = map[string]codecSpec{
+	"vp8": {Encoder: "libvpx", MinCRF: 4, MaxCRF: 63},
+	"vp9": {Encoder: "libvpx-vp9", MinCRF: 0, MaxCRF: 63},
+	// Rango común a libaom-av1 y libsvtav1 (este último no admite 0)
+	"av1": {Encoder: "libaom-av1", MinCRF: 1, MaxCRF: 63},
+}
+
+// lookupCodec devuelve la especificación del códec indicado
+func lookupCodec(name string) (codecSpec, error) {
+	if name == "" {
+		name = "vp9"
+	}
+	spec, ok := videoCodecs[strings.ToLower(name)]
+	if !ok {
+		var names []string
+		for n := range videoCodecs {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return codecSpec{}, fmt.Errorf("códec no soportado: '%s' (valores válidos: %s)", name, strings.Join(names, ", "))
+	}
+	return spec, nil
+}
+
+// presetSpec agrupa los parámetros de velocidad de cada encoder para un preset
+type presetSpec struct {
+	Deadline string // libvpx (vp8/vp9)
+	CPUUsed  int    // libvpx y libaom-av1
+	SVT      int    // libsvtav1
+	X264     string // libx264
+	NVENC    string // h264_nvenc
+	QSV      string // h264_qsv
+}
+
+// encodingPresets relaciona los nombres amigables con valores concretos por encoder
+var encodingPresets = map[string]presetSpec{
+	"fast":     {Deadline: "realtime", CPUUsed: 8, SVT: 10, X264: "veryfast", NVENC: "p2", QSV: "veryfast"},
+	"balanced": {Deadline: "good", CPUUsed: 4, SVT: 8, X264: "medium", NVENC: "p4", QSV: "medium"},
+	"slow":     {Deadline: "best", CPUUsed: 1, SVT: 4, X264: "slow", NVENC: "p6", QSV: "veryslow"},
+}
+
+// hwAccelSpec describe cómo codificar H.264 con una aceleradora por hardware
+type hwAccelSpec struct {
+	Encoder     string   // Encoder de ffmpeg
+	InitArgs    []string // Argumentos que van antes de -i para inicializar el dispositivo
+	Upload      string   // Filtro final que sube los cuadros a la GPU (si hace falta)
+	QualityFlag string   // Opción equivalente a -crf para este encoder
+	PixFmt      string   // Formato de píxel que acepta el encoder (vacío si lo define Upload)
+}
+
+// hwAccelerators contiene las aceleradoras soportadas. El soporte de VP9 por
+// hardware es muy desparejo, así que solo se ofrecen para la salida mp4 (H.264)
+var hwAccelerators = map[string]hwAccelSpec{
+	"vaapi": {
+		Encoder:     "h264_vaapi",
+		InitArgs:    []string{"-vaapi_device", "/dev/dri/renderD128"},
+		Upload:      "format=nv12,hwupload",
+		QualityFlag: "-qp",
+	},
+	"nvenc": {
+		Encoder:     "h264_nvenc",
+		InitArgs:    []string{"-hwaccel", "cuda"},
+		QualityFlag: "-cq",
+		PixFmt:      "yuv420p",
+	},
+	"qsv": {
+		Encoder:     "h264_qsv",
+		InitArgs:    []string{"-hwaccel", "qsv"},
+		QualityFlag: "-global_quality",
+		PixFmt:      "nv12",
+	},
+}
+
+// lookupPreset devuelve los parámetros del preset indicado
+func lookupPreset(name string) (presetSpec, error) {
+	if name == "" {
+		name = "balanced"
+	}
+	preset, ok := encodingPresets[strings.ToLower(name)]
+	if !ok {
+		return presetSpec{}, fmt.Errorf("preset no soportado: '%s' (valores válidos: fast, balanced, slow)", name)
+	}
+	return preset, nil
+}
+
+// audioCodecs relaciona los códecs de audio soportados con su encoder de ffmpeg
+var audioCodecs = map[string]string{
+	"opus":   "libopus",
+	"vorbis": "libvorbis",
+}
+
+// ignoredMetadataTags son etiquetas propias del contenedor o del encoder original
+// que no tiene sentido copiar al archivo convertido
+var ignoredMetadataTags = map[string]bool{
+	"encoder":           true,
+	"major_brand":       true,
+	"minor_version":     true,
+	"compatible_brands": true,
+}
+
+// audioBitrateRe valida bitrates de audio como "96k" o "128000"
+var audioBitrateRe = regexp.MustCompile(`^\d+k?$`)
+
+// bitrateRe valida bitrates de video en kbps ("1500", "1500k") o Mbps ("2M", "2.5M")
+var bitrateRe = regexp.MustCompile(`^(\d+(?:\.\d+)?)([kKmM]?)$`)
+
+// parseBitrate convierte un bitrate de video a kbps (sin sufijo se toma en kbps)
+func parseBitrate(spec string) (int, error) {
+	match := bitrateRe.FindStringSubmatch(spec)
+	if match == nil {
+		return 0, fmt.Errorf("bitrate inválido: '%s' (ejemplos: 1500k, 2M)", spec)
+	}
+	value, _ := strconv.ParseFloat(match[1], 64)
+	if strings.EqualFold(match[2], "m") {
+		value *= 1000
+	}
+	if value < 1 {
+		return 0, fmt.Errorf("bitrate inválido: '%s' (ejemplos: 1500k, 2M)", spec)
+	}
+	return int(value), nil
+}
+
+// qualityToBitrate convierte la calidad (0-100) en un bitrate de video aproximado
+// en kbps. La curva tiene tres tramos lineales que se unen en 30 y 70:
+//
+//	0-29:   100-486 kbps (calidades muy bajas, para previsualizar)
+//	30-69:  500-1962 kbps (calidades medias, uso general)
+//	70-100: 2000-6000 kbps (calidades altas)
+func qualityToBitrate(quality int) int {
+	switch {
+	case quality < 30:
+		return 100 + (400*quality)/30
+	case quality < 70:
+		return 500 + (1500*(quality-30))/40
+	default:
+		return 2000 + (4000*(quality-70))/30
+	}
+}
+
+// audioBitrateKbps convierte un bitrate de audio ya validado ("96k" o "128000") a
+// kbps; vacío equivale a 96k
+func audioBitrateKbps(spec string) int {
+	if spec == "" {
+		return 96
+	}
+	if value, ok := strings.CutSuffix(spec, "k"); ok {
+		kbps, _ := strconv.Atoi(value)
+		return kbps
+	}
+	bps, _ := strconv.Atoi(spec)
+	return bps / 1000
+}
+
+// Márgenes de -target-size: la parte del tamaño que se reserva para el
+// contenedor y el bitrate de video por debajo del cual la imagen es inutilizable
+const (
+	targetSizeOverhead = 0.02
+	minTargetKbps      = 50
+)
+
+// targetBitrate calcula el bitrate de video (kbps) para que una salida de duration
+// segundos con audioKbps de audio ocupe targetSize bytes. Si no alcanza para un
+// video mínimamente visible devuelve minTargetKbps y una advertencia
+func targetBitrate(targetSize int64, duration float64, audioKbps int) (int, string, error) {
+	if duration <= 0 {
+		return 0, "", errors.New("-target-size requiere conocer la duración del video y ffprobe no la informó")
+	}
+	totalKbps := float64(targetSize) * 8 * (1 - targetSizeOverhead) / 1000 / duration
+	videoKbps := int(totalKbps) - audioKbps
+	if videoKbps < minTargetKbps {
+		return minTargetKbps, fmt.Sprintf(
+			"-target-size es demasiado chico para %.0f segundos (quedarían %d kbps de video); "+
+				"se usan %d kbps y la salida lo superará", duration, videoKbps, minTargetKbps), nil
+	}
+	return videoKbps, "", nil
+}
+
+// autoKeyIntSeconds es la separación entre keyframes con -keyint auto
+const autoKeyIntSeconds = 2
+
+// parseKeyInt interpreta -keyint: devuelve 0 para "auto"
+func parseKeyInt(spec string) (int, error) {
+	if spec == "auto" {
+		return 0, nil
+	}
+	frames, err := strconv.Atoi(spec)
+	if err != nil || frames <= 0 {
+		return 0, fmt.Errorf("-keyint inválido: '%s' (use una cantidad de cuadros o auto)", spec)
+	}
+	return frames, nil
+}
+
+// maxDefaultThreads limita los hilos automáticos: los encoders dejan de
+// escalar bastante antes y con más solo se desperdicia memoria
+const maxDefaultThreads = 16
+
+// defaultThreads calcula la cantidad de hilos de ffmpeg cuando no se indicó ninguna
+func defaultThreads() int {
+	return min(runtime.NumCPU(), maxDefaultThreads)
+}
+
+// threadsPerWorker reparte los núcleos entre los trabajadores para que la suma
+// de hilos de todos los ffmpeg en paralelo ronde la cantidad de núcleos
+func threadsPerWorker(workers int) int {
+	if workers <= 1 {
+		return defaultThreads()
+	}
+	return max(1, min(runtime.NumCPU()/workers, maxDefaultThreads))
+}
+
+// tileColumns devuelve el valor de -tile-columns para VP9: el logaritmo en base 2
+// de la cantidad de columnas, una por hilo como máximo. libvpx lo reduce por su
+// cuenta si el ancho del video no alcanza para tantas columnas
+func tileColumns(threads int) int {
+	columns := 0
+	for 1<<(columns+1) <= threads && columns < 6 {
+		columns++
+	}
+	return columns
+}
+
+// streamLoopCount calcula cuántas repeticiones extra (-stream_loop) necesita un
+// original de duration segundos para llegar a target; 0 si ya alcanza
+func streamLoopCount(duration, target float64) int {
+	if duration <= 0 || duration >= target {
+		return 0
+	}
+	return int(math.Ceil(target/duration)) - 1
+}
+
+// hexColorRe reconoce un color #RRGGBB
+var hexColorRe = regexp.MustCompile(`^#([0-9a-fA-F]{2})([0-9a-fA-F]{2})([0-9a-fA-F]{2})$`)
+
+// parseDuotone interpreta -duotone con el formato "#sombras,#luces" y devuelve
+// cada color como componentes RGB entre 0 y 255
+func parseDuotone(spec string) ([3]int, [3]int, error) {
+	invalid := fmt.Errorf("duotono inválido: '%s' (formato esperado: #sombras,#luces, ej: #1b1b3a,#f2d479)", spec)
+
+	var colors [2][3]int
+	parts := strings.Split(spec, ",")
+	if len(parts) != 2 {
+		return colors[0], colors[1], invalid
+	}
+	for i, part := range parts {
+		match := hexColorRe.FindStringSubmatch(strings.TrimSpace(part))
+		if match == nil {
+			return colors[0], colors[1], invalid
+		}
+		for c := range 3 {
+			value, _ := strconv.ParseUint(match[c+1], 16, 8)
+			colors[i][c] = int(value)
+		}
+	}
+	return colors[0], colors[1], nil
+}
+
+// duotoneCurves arma el filtro curves que lleva el negro al color de las sombras
+// y el blanco al de las luces, con una transición lineal entre ambos
+func duotoneCurves(shadows, highlights [3]int) string {
+	var channels [3]string
+	for c, name := range []string{"r", "g", "b"} {
+		channels[c] = fmt.Sprintf("%s='0/%s 1/%s'", name,
+			strconv.FormatFloat(float64(shadows[c])/255, 'f', 3, 64),
+			strconv.FormatFloat(float64(highlights[c])/255, 'f', 3, 64))
+	}
+	return "curves=" + strings.Join(channels[:], ":")
+}
+
+// padColorRe valida los colores de -pad-color: un nombre de ffmpeg (black, white,
+// ...) o un valor hexadecimal #RRGGBB / 0xRRGGBB, con transparencia opcional
+var padColorRe = regexp.MustCompile(`^([a-zA-Z]+|(#|0x)[0-9a-fA-F]{6}([0-9a-fA-F]{2})?)(@[0-9.]+)?$`)
+
+// yadifModes traduce los modos de -deinterlace al parámetro mode de yadif
+var yadifModes = map[string]string{
+	"frame": "send_frame",
+	"field": "send_field",
+}
+
+// tonemapFilter convierte HDR (PQ o HLG, bt2020) a SDR bt709. zscale necesita
+// trabajar en punto flotante para que tonemap reciba luz lineal
+const tonemapFilter = "zscale=t=linear:npl=100,format=gbrpf32le,zscale=p=bt709," +
+	"tonemap=tonemap=hable:desat=0,zscale=t=bt709:m=bt709:r=tv,format=yuv420p"
+
+// scaleAlgorithms son las interpolaciones de scale que acepta -scale-algo
+var scaleAlgorithms = []string{"bilinear", "bicubic", "lanczos", "neighbor"}
+
+// scaleFlags devuelve la opción flags de scale para el algoritmo pedido, o una
+// cadena vacía para dejar la interpolación por defecto de ffmpeg
+func scaleFlags(algo string) string {
+	if algo == "" {
+		return ""
+	}
+	return ":flags=" + algo
+}
+
+// ditherModes son los algoritmos de tramado de paletteuse que acepta -dither.
+// none deja colores planos (pixel art); el resto suaviza los degradados
+var ditherModes = []string{"none", "bayer", "floyd_steinberg", "sierra2"}
+
+// ditherOption devuelve la opción dither de paletteuse precedida por sep, o
+// una cadena vacía para usar el tramado por defecto de ffmpeg
+func ditherOption(mode, sep string) string {
+	if mode == "" {
+		return ""
+	}
+	return sep + "dither=" + mode
+}
+
+// boomerangWarnSeconds es la duración a partir de la cual -boomerang avisa del
+// consumo de memoria: reverse guarda todos los cuadros del clip antes de emitirlos
+const boomerangWarnSeconds = 30
+
+// retryBackoff es la espera antes del primer reintento; se duplica en cada uno
+const retryBackoff = time.Second
+
+// ValidateOptions verifica que las opciones de conversión sean válidas
+func ValidateOptions(opts ConversionOptions) error {
+	if opts.Quality < 0 || opts.Quality > 100 {
+		return errors.New("la calidad debe estar entre 0 y 100")
+	}
+	spec, err := lookupCodec(opts.Codec)
+	if err != nil {
+		return err
+	}
+	if _, err := lookupPreset(opts.Preset); err != nil {
+		return err
+	}
+	if opts.OutputFormat == "mp4" {
+		// MP4 siempre usa H.264, con su propio rango de CRF
+		spec = codecSpec{Encoder: "libx264", MinCRF: 0, MaxCRF: 51}
+	}
+	if opts.CRF != -1 && (opts.CRF < spec.MinCRF || opts.CRF > spec.MaxCRF) {
+		return fmt.Errorf("el CRF debe estar entre %d y %d para %s", spec.MinCRF, spec.MaxCRF, spec.Encoder)
+	}
+	if opts.FPS < 0 || opts.FPS > 240 {
+		return errors.New("los fps deben ser mayores que 0 y como máximo 240")
+	}
+	switch opts.Rotate {
+	case 0, 90, 180, 270:
+	default:
+		return fmt.Errorf("rotación no soportada: %d (valores válidos: 90, 180, 270)", opts.Rotate)
+	}
+	if opts.Crop != "" {
+		if _, err := parseCrop(opts.Crop); err != nil {
+			return err
+		}
+	}
+	if opts.Resize != "" {
+		if _, _, err := parseResize(opts.Resize); err != nil {
+			return err
+		}
+	}
+	if opts.Scale < 0 || opts.Scale > 400 {
+		return errors.New("el porcentaje de -scale debe ser mayor que 0 y como máximo 400")
+	}
+	if opts.Pad && opts.Resize == "" {
+		return errors.New("-pad requiere -resize")
+	}
+	if opts.PadColor != "" && !padColorRe.MatchString(opts.PadColor) {
+		return fmt.Errorf("color inválido: '%s' (ejemplos: black, white, #1a1a1a)", opts.PadColor)
+	}
+	if opts.Scale > 0 && opts.Resize != "" {
+		return errors.New("-scale y -resize no se pueden usar juntos")
+	}
+	if opts.Denoise < 0 || opts.Denoise > 20 {
+		return errors.New("la intensidad de -denoise debe estar entre 0 y 20")
+	}
+	if opts.Sharpen < 0 || opts.Sharpen > 5 {
+		return errors.New("la intensidad de -sharpen debe estar entre 0 y 5")
+	}
+	if opts.Filters != "" {
+		for _, name := range filterNames(opts.Filters) {
+			switch {
+			case name == "scale" && opts.PixelateFactor > 0:
+				return errors.New("-pixelate no se puede combinar con un filtro scale en -filters: ambos cambian la resolución")
+			case (name == "palettegen" || name == "paletteuse") && (opts.PaletteColors > 0 || opts.OutputFormat == "gif"):
+				return fmt.Errorf("el filtro %s de -filters choca con la paleta que genera -colors/-format gif", name)
+			}
+		}
+	}
+	if _, ok := yadifModes[opts.Deinterlace]; opts.Deinterlace != "" && !ok {
+		return fmt.Errorf("modo de desentrelazado no soportado: '%s' (valores válidos: frame, field)", opts.Deinterlace)
+	}
+	if opts.WatermarkPos != "" {
+		if opts.Watermark == "" {
+			return errors.New("-watermark-pos requiere -watermark")
+		}
+		if _, ok := watermarkPositions[strings.ToLower(opts.WatermarkPos)]; !ok {
+			return fmt.Errorf("-watermark-pos inválido: '%s' (valores válidos: topleft, top, topright, left, center, right, bottomleft, bottom, bottomright)", opts.WatermarkPos)
+		}
+	}
+	if opts.WatermarkOpacity < 0 || opts.WatermarkOpacity > 1 {
+		return errors.New("-watermark-opacity debe estar entre 0 y 1")
+	}
+	if opts.Subtitles != "" {
+		if _, _, err := parseSubtitles(opts.Subtitles); err != nil {
+			return err
+		}
+	}
+	if opts.Duotone != "" {
+		if _, _, err := parseDuotone(opts.Duotone); err != nil {
+			return err
+		}
+		if opts.Grayscale {
+			return errors.New("-grayscale y -duotone no se pueden usar juntos")
+		}
+	}
+	if opts.PixelateFactor != 0 && (opts.PixelateFactor < 2 || opts.PixelateFactor > 64) {
+		return errors.New("el factor de pixelado debe estar entre 2 y 64")
+	}
+	if opts.PaletteColors != 0 && (opts.PaletteColors < 2 || opts.PaletteColors > 256) {
+		return errors.New("la cantidad de colores debe estar entre 2 y 256")
+	}
+	if opts.MinFree < 0 {
+		return errors.New("-min-free no puede ser negativo")
+	}
+	if opts.ScaleAlgo != "" && !slices.Contains(scaleAlgorithms, opts.ScaleAlgo) {
+		return fmt.Errorf("algoritmo de escalado no soportado: '%s' (valores válidos: %s)", opts.ScaleAlgo, strings.Join(scaleAlgorithms, ", "))
+	}
+	if opts.Dither != "" {
+		if !slices.Contains(ditherModes, opts.Dither) {
+			return fmt.Errorf("tramado no soportado: '%s' (valores válidos: %s)", opts.Dither, strings.Join(ditherModes, ", "))
+		}
+		if opts.PaletteColors == 0 && opts.OutputFormat != "gif" {
+			return errors.New("-dither requiere -colors o salida gif")
+		}
+	}
+	start, err := parseTimestamp(opts.StartTime)
+	if err != nil {
+		return err
+	}
+	end, err := parseTimestamp(opts.EndTime)
+	if err != nil {
+		return err
+	}
+	if opts.EndTime != "" && end <= start {
+		return errors.New("-end debe ser posterior a -start")
+	}
+	if opts.Retries < 0 {
+		return errors.New("la cantidad de reintentos no puede ser negativa")
+	}
+	if opts.TargetSize < 0 {
+		return errors.New("el tamaño objetivo no puede ser negativo")
+	}
+	if opts.TargetSize > 0 {
+		switch {
+		case opts.Bitrate != "":
+			return errors.New("-target-size y -bitrate no se pueden usar juntos")
+		case opts.CRF != -1:
+			return errors.New("-target-size y -crf no se pueden usar juntos")
+		case opts.OutputFormat == "gif":
+			return errors.New("-target-size no se aplica al formato gif")
+		}
+	}
+	if opts.Bitrate != "" {
+		if _, err := parseBitrate(opts.Bitrate); err != nil {
+			return fmt.Errorf("-bitrate: %w", err)
+		}
+		if opts.CRF != -1 {
+			return errors.New("-bitrate y -crf no se pueden usar juntos")
+		}
+		if opts.OutputFormat == "gif" {
+			return errors.New("-bitrate no se aplica al formato gif")
+		}
+	}
+	if opts.MaxRate != "" {
+		if _, err := parseBitrate(opts.MaxRate); err != nil {
+			return fmt.Errorf("-maxrate: %w", err)
+		}
+		if opts.OutputFormat == "gif" {
+			return errors.New("-maxrate no se aplica al formato gif")
+		}
+	}
+	if opts.KeyInt != "" {
+		if _, err := parseKeyInt(opts.KeyInt); err != nil {
+			return err
+		}
+		if opts.OutputFormat == "gif" {
+			return errors.New("-keyint no se aplica al formato gif")
+		}
+	}
+	if opts.BufSize != "" {
+		if opts.MaxRate == "" {
+			return errors.New("-bufsize requiere -maxrate")
+		}
+		if _, err := parseBitrate(opts.BufSize); err != nil {
+			return fmt.Errorf("-bufsize: %w", err)
+		}
+	}
+	if err := validateOutputTemplate(opts.OutputTemplate); err != nil {
+		return err
+	}
+	if opts.Overwrite && opts.SkipExisting {
+		return errors.New("-overwrite y -skip-existing no se pueden usar juntos")
+	}
+	if opts.RemoveInvalid && !opts.Verify {
+		return errors.New("-remove-invalid requiere -verify")
+	}
+	if opts.Alpha {
+		spec, err := lookupCodec(opts.Codec)
+		if err != nil || spec.Encoder != "libvpx-vp9" || (opts.OutputFormat != "" && opts.OutputFormat != "webm") || opts.HWAccel != "" {
+			return errors.New("-alpha solo se puede usar con el códec vp9 en WebM")
+		}
+	}
+	if opts.LagInFrames >= 0 || opts.AutoAltRef >= 0 || opts.ArnrMaxFrames >= 0 {
+		spec, err := lookupCodec(opts.Codec)
+		if err != nil || spec.Encoder != "libvpx-vp9" || (opts.OutputFormat != "" && opts.OutputFormat != "webm") {
+			return errors.New("-lag-in-frames, -auto-alt-ref y -arnr-maxframes solo se aplican al códec vp9")
+		}
+	}
+	if opts.LagInFrames > 25 {
+		return errors.New("-lag-in-frames debe estar entre 0 y 25")
+	}
+	if opts.AutoAltRef > 6 {
+		return errors.New("-auto-alt-ref debe estar entre 0 y 6")
+	}
+	if opts.ArnrMaxFrames > 15 {
+		return errors.New("-arnr-maxframes debe estar entre 0 y 15")
+	}
+	if opts.Sample < 0 {
+		return errors.New("-sample debe ser una cantidad de segundos positiva")
+	}
+	if opts.Sample > 0 && opts.EndTime != "" {
+		return errors.New("-sample y -end no se pueden usar juntos")
+	}
+	if opts.FadeIn < 0 || opts.FadeOut < 0 {
+		return errors.New("-fade-in y -fade-out deben ser una cantidad de segundos positiva")
+	}
+	if opts.Speed != 0 && (opts.Speed < minSpeed || opts.Speed > maxSpeed) {
+		return fmt.Errorf("-speed debe estar entre %g y %g", minSpeed, maxSpeed)
+	}
+	if opts.LoopTo != "" {
+		loopTo, err := parseTimestamp(opts.LoopTo)
+		if err != nil {
+			return fmt.Errorf("-loop-to: %w", err)
+		}
+		if loopTo <= 0 {
+			return errors.New("-loop-to debe ser mayor que 0")
+		}
+		if opts.StartTime != "" || opts.EndTime != "" || opts.Sample > 0 || opts.Boomerang || changesSpeed(opts) {
+			return errors.New("-loop-to no se puede usar con -start, -end, -sample, -boomerang ni -speed")
+		}
+	}
+	minDuration, maxDuration, err := durationLimits(opts)
+	if err != nil {
+		return err
+	}
+	if maxDuration > 0 && minDuration > maxDuration {
+		return errors.New("-min-duration no puede ser mayor que -max-duration")
+	}
+	if opts.DeleteSource && (opts.StartTime != "" || opts.EndTime != "" || opts.Sample > 0) {
+		return errors.New("-delete-source no se puede usar con -start/-end/-sample: la salida sería solo un segmento del original")
+	}
+	if opts.TwoOutput && !opts.Thumbnail {
+		return errors.New("-two-output requiere -thumbnail")
+	}
+	if opts.Thumbnail {
+		if _, err := thumbnailOffset(opts.ThumbnailTime, 0); err != nil {
+			return err
+		}
+		switch opts.ThumbnailFormat {
+		case "", "jpg", "png", "webp":
+		default:
+			return fmt.Errorf("formato de miniatura no soportado: '%s' (valores válidos: jpg, png, webp)", opts.ThumbnailFormat)
+		}
+	}
+	switch opts.OutputFormat {
+	case "", "webm", "mp4":
+	case "gif":
+		if opts.TwoPass {
+			return errors.New("la codificación en dos pasadas no se aplica al formato gif")
+		}
+	default:
+		return fmt.Errorf("formato de salida no soportado: '%s' (valores válidos: webm, mp4, gif)", opts.OutputFormat)
+	}
+	if opts.AudioCodec != "" {
+		if _, ok := audioCodecs[strings.ToLower(opts.AudioCodec)]; !ok {
+			return fmt.Errorf("códec de audio no soportado: '%s' (valores válidos: opus, vorbis)", opts.AudioCodec)
+		}
+	}
+	if opts.AudioBitrate != "" && !audioBitrateRe.MatchString(opts.AudioBitrate) {
+		return fmt.Errorf("bitrate de audio inválido: '%s' (ejemplos: 96k, 128k)", opts.AudioBitrate)
+	}
+	if opts.LoudnessTarget != 0 && (opts.LoudnessTarget < -70 || opts.LoudnessTarget > -5) {
+		return errors.New("la sonoridad objetivo debe estar entre -70 y -5 LUFS")
+	}
+	if opts.HWAccel != "" {
+		if _, ok := hwAccelerators[strings.ToLower(opts.HWAccel)]; !ok {
+			return fmt.Errorf("aceleración por hardware no soportada: '%s' (valores válidos: nvenc, qsv, vaapi)", opts.HWAccel)
+		}
+		if opts.OutputFormat != "mp4" {
+			return errors.New("-hwaccel solo se aplica a la salida mp4 (H.264); usa -format mp4")
+		}
+		if opts.TwoPass {
+			return errors.New("la codificación en dos pasadas no se aplica con -hwaccel")
+		}
+	}
+	return nil
+}
+
+// snakeCaseFilename convierte un nombre de archivo a snake_case
+func snakeCaseFilename(filename string) string {
+	base := filepath.Base(filename)
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+
+	// Reemplazar caracteres no alfanuméricos con guiones bajos
+	re := regexp.MustCompile(`[^a-zA-Z0-9]`)
+	name = re.ReplaceAllString(name, "_")
+
+	// Convertir camelCase a snake_case
+	re = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+	name = re.ReplaceAllString(name, "${1}_${2}")
+
+	// Convertir a minúsculas
+	name = strings.ToLower(name)
+
+	// Eliminar guiones bajos múltiples
+	re = regexp.MustCompile(`_+`)
+	name = re.ReplaceAllString(name, "_")
+
+	// Eliminar guiones bajos al inicio o final
+	name = strings.Trim(name, "_")
+
+	return name
+}
+
+// outputFileName devuelve el nombre del archivo convertido: en snake_case o,
+// con -keep-name, el nombre original con la extensión del formato de salida
+// (y el sufijo _sample con -sample).
+// Con -output-template el nombre sale de la plantilla; info puede ser nil si
+// la plantilla no usa las dimensiones
+func outputFileName(inputPath string, opts ConversionOptions, info *VideoInfo) string {
+	base := filepath.Base(inputPath)
+	name := snakeCaseFilename(base)
+	if opts.KeepName {
+		name = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	if opts.OutputTemplate != "" {
+		name = expandOutputTemplate(opts.OutputTemplate, name, info, opts)
+	} else {
+		name += outputExtension(opts)
+	}
+	// Las muestras no deben confundirse con (ni pisar) una conversión completa
+	if opts.Sample > 0 {
+		ext := filepath.Ext(name)
+		name = strings.TrimSuffix(name, ext) + "_sample" + ext
+	}
+	return name
+}
+
+// outputTemplateRe reconoce los marcadores de -output-template
+var outputTemplateRe = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// outputTemplateFields son los marcadores válidos en -output-template
+var outputTemplateFields = []string{"name", "width", "height", "quality", "codec", "date"}
+
+// validateOutputTemplate rechaza marcadores desconocidos y rutas fuera del directorio de salida
+func validateOutputTemplate(template string) error {
+	for _, match := range outputTemplateRe.FindAllStringSubmatch(template, -1) {
+		if !slices.Contains(outputTemplateFields, match[1]) {
+			return fmt.Errorf("marcador desconocido en -output-template: '{%s}' (valores válidos: %s)",
+				match[1], strings.Join(outputTemplateFields, ", "))
+		}
+	}
+	if filepath.IsAbs(template) || slices.Contains(strings.Split(filepath.ToSlash(template), "/"), "..") {
+		return errors.New("-output-template debe ser una ruta relativa al directorio de salida")
+	}
+	return nil
+}
+
+// templateNeedsInfo indica si la plantilla usa datos que requieren analizar el original
+func templateNeedsInfo(template string) bool {
+	return strings.Contains(template, "{width}") || strings.Contains(template, "{height}")
+}
+
+// expandOutputTemplate reemplaza los marcadores de la plantilla. Las dimensiones
+// son las del original
+func expandOutputTemplate(template, name string, info *VideoInfo, opts ConversionOptions) string {
+	var width, height int
+	if info != nil {
+		width, height = info.Width, info.Height
+	}
+
+	codec := strings.ToLower(opts.Codec)
+	switch {
+	case opts.OutputFormat == "mp4":
+		codec = "h264"
+	case opts.OutputFormat == "gif":
+		codec = "gif"
+	case codec == "":
+		codec = "vp9"
+	}
+
+	values := map[string]string{
+		"name":    name,
+		"width":   strconv.Itoa(width),
+		"height":  strconv.Itoa(height),
+		"quality": strconv.Itoa(opts.Quality),
+		"codec":   codec,
+		"date":    time.Now().Format("2006-01-02"),
+	}
+	expanded := outputTemplateRe.ReplaceAllStringFunc(template, func(match string) string {
+		return values[match[1:len(match)-1]]
+	})
+	if filepath.Ext(expanded) == "" {
+		expanded += outputExtension(opts)
+	}
+	return expanded
+}
+
+// parseTimestamp interpreta un momento del video en segundos ("90", "12.5") o
+// como HH:MM:SS / MM:SS ("01:30", "00:01:30.5"). Vacío equivale a 0
+func parseTimestamp(spec string) (float64, error) {
+	if spec == "" {
+		return 0, nil
+	}
+
+	parts := strings.Split(spec, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("momento inválido: '%s' (use segundos o HH:MM:SS)", spec)
+	}
+	var seconds float64
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(part, 64)
+		// Solo el último componente puede tener decimales o pasar de 59
+		if err != nil || value < 0 || (i < len(parts)-1 && value != float64(int(value))) ||
+			(i > 0 && value >= 60) {
+			return 0, fmt.Errorf("momento inválido: '%s' (use segundos o HH:MM:SS)", spec)
+		}
+		seconds = seconds*60 + value
+	}
+	return seconds, nil
+}
+
+// filterInputSize calcula el tamaño de los cuadros antes del escalado: el del
+// original, con ancho y alto intercambiados si se gira 90° o 270° (ffmpeg aplica
+// la rotación de los metadatos por su cuenta) y reemplazados por los de -crop
+func filterInputSize(info *VideoInfo, opts ConversionOptions) (int, int) {
+	width, height := info.Width, info.Height
+	if (info.Rotation+opts.Rotate)%180 != 0 {
+		width, height = height, width
+	}
+	if crop, err := parseCrop(opts.Crop); err == nil {
+		width, height = crop.Width, crop.Height
+	}
+	return width, height
+}
+
+// cropRect es la región a conservar con -crop
+type cropRect struct {
+	X, Y          int
+	Width, Height int
+}
+
+// parseCrop interpreta -crop con el formato x:y:ancho:alto
+func parseCrop(spec string) (cropRect, error) {
+	invalid := fmt.Errorf("recorte inválido: '%s' (formato esperado: x:y:ancho:alto, ej: 0:0:640:360)", spec)
+
+	parts := strings.Split(spec, ":")
+	if len(parts) != 4 {
+		return cropRect{}, invalid
+	}
+	var values [4]int
+	for i, part := range parts {
+		value, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || value < 0 {
+			return cropRect{}, invalid
+		}
+		values[i] = value
+	}
+	if values[2] == 0 || values[3] == 0 {
+		return cropRect{}, fmt.Errorf("recorte inválido: '%s' (el ancho y el alto deben ser mayores que 0)", spec)
+	}
+	return cropRect{X: values[0], Y: values[1], Width: values[2], Height: values[3]}, nil
+}
+
+// parseResize interpreta -resize con el formato anchoxalto
+func parseResize(spec string) (int, int, error) {
+	invalid := fmt.Errorf("tamaño inválido: '%s' (formato esperado: anchoxalto, ej: 1280x720)", spec)
+
+	w, h, found := strings.Cut(strings.ToLower(spec), "x")
+	if !found {
+		return 0, 0, invalid
+	}
+	width, errW := strconv.Atoi(strings.TrimSpace(w))
+	height, errH := strconv.Atoi(strings.TrimSpace(h))
+	if errW != nil || errH != nil || width <= 0 || height <= 0 {
+		return 0, 0, invalid
+	}
+	return width, height, nil
+}
+
+// evenDimension redondea una medida al par más cercano, con un mínimo de 2 píxeles:
+// yuv420p submuestrea el color en bloques de 2x2 y no admite medidas impares
+func evenDimension(value float64) int {
+	return max(int(value/2+0.5)*2, 2)
+}
+
+// rotationFilters devuelve los filtros que giran el video en sentido horario
+func rotationFilters(degrees int) []string {
+	switch ((degrees % 360) + 360) % 360 {
+	case 90:
+		return []string{"transpose=clock"}
+	case 180:
+		return []string{"hflip", "vflip"}
+	case 270:
+		return []string{"transpose=cclock"}
+	}
+	return nil
+}
+
+// thumbnailOffset calcula en qué segundo tomar la miniatura. spec puede ser una
+// cantidad de segundos o un porcentaje de la duración; vacío equivale a "10%"
+func thumbnailOffset(spec string, duration float64) (float64, error) {
+	if spec == "" {
+		spec = "10%"
+	}
+
+	if strings.HasSuffix(spec, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(spec, "%"), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return 0, fmt.Errorf("momento de miniatura inválido: '%s' (use segundos o un porcentaje entre 0%% y 100%%)", spec)
+		}
+		return duration * percent / 100, nil
+	}
+
+	seconds, err := strconv.ParseFloat(spec, 64)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("momento de miniatura inválido: '%s' (use segundos o un porcentaje entre 0%% y 100%%)", spec)
+	}
+	return seconds, nil
+}
+
+// outputExtension devuelve la extensión del archivo de salida según el formato
+func outputExtension(opts ConversionOptions) string {
+	if opts.OutputFormat == "" {
+		return ".webm"
+	}
+	return "." + opts.OutputFormat
+}
+
+// defaultVideoExtensions son las extensiones que se buscan por defecto en modo directorio
+var defaultVideoExtensions = []string{".mp4", ".avi", ".mov", ".mkv", ".flv", ".wmv", ".webm"}
+
+// normalizeExtension lleva una extensión a minúsculas y con punto inicial ("MP4" -> ".mp4")
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// matchesAny indica si la ruta relativa (o solo su nombre) coincide con alguno de
+// los patrones glob
+func matchesAny(patterns []string, relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	name := filepath.Base(relPath)
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(pattern)
+		if ok, _ := filepath.Match(pattern, relPath); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// watermarkMargin es la separación en píxeles entre la marca de agua y el borde
+const watermarkMargin = "10"
+
+// watermarkPositions traduce -watermark-pos a las coordenadas x:y de overlay,
+// donde W y H son el tamaño del video y w y h el de la imagen
+var watermarkPositions = map[string]string{
+	"topleft":     watermarkMargin + ":" + watermarkMargin,
+	"top":         "(W-w)/2:" + watermarkMargin,
+	"topright":    "W-w-" + watermarkMargin + ":" + watermarkMargin,
+	"left":        watermarkMargin + ":(H-h)/2",
+	"center":      "(W-w)/2:(H-h)/2",
+	"right":       "W-w-" + watermarkMargin + ":(H-h)/2",
+	"bottomleft":  watermarkMargin + ":H-h-" + watermarkMargin,
+	"bottom":      "(W-w)/2:H-h-" + watermarkMargin,
+	"bottomright": "W-w-" + watermarkMargin + ":H-h-" + watermarkMargin,
+}
+
+// subtitleExtensions son los formatos de subtítulos que entiende el filtro subtitles
+var subtitleExtensions = []string{".srt", ".ass", ".ssa", ".vtt"}
+
+// parseSubtitles interpreta -subtitles: devuelve la ruta del archivo o, con
+// "embedded:N", un índice mayor o igual a 0 para la pista N del original
+func parseSubtitles(spec string) (string, int, error) {
+	if value, ok := strings.CutPrefix(spec, "embedded:"); ok {
+		index, err := strconv.Atoi(value)
+		if err != nil || index < 0 {
+			return "", 0, fmt.Errorf("-subtitles inválido: '%s' (use embedded:N con N desde 0)", spec)
+		}
+		return "", index, nil
+	}
+	if !slices.Contains(subtitleExtensions, strings.ToLower(filepath.Ext(spec))) {
+		return "", 0, fmt.Errorf("formato de subtítulos no soportado: '%s' (valores válidos: %s)",
+			spec, strings.Join(subtitleExtensions, ", "))
+	}
+	return spec, -1, nil
+}
+
+// Escapado de una ruta dentro de un filtro: primero como valor de una opción
+// (donde ':' separa opciones) y después como parte del filtergraph (donde ',',
+// ';' y los corchetes separan filtros y etiquetas)
+var (
+	filterOptionEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`)
+	filterGraphEscaper  = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`)
+)
+
+// escapeFilterPath prepara una ruta para usarla como opción de un filtro de -vf.
+// Las barras de Windows se cambian por '/' para no sumar más niveles de escapado
+func escapeFilterPath(path string) string {
+	return filterGraphEscaper.Replace(filterOptionEscaper.Replace(filepath.ToSlash(path)))
+}
+
+// filterLabelRe reconoce las etiquetas de entrada de un filtro ("[in][p]")
+var filterLabelRe = regexp.MustCompile(`^(\[[^\]]*\]\s*)+`)
+
+// filterNames devuelve los nombres de los filtros de un filtergraph
+// ("crop=100:100,split[a][b];[a]reverse" -> crop, split, reverse)
+func filterNames(graph string) []string {
+	var names []string
+	for _, chain := range strings.Split(graph, ";") {
+		for _, filter := range strings.Split(chain, ",") {
+			filter = filterLabelRe.ReplaceAllString(strings.TrimSpace(filter), "")
+			name, _, _ := strings.Cut(filter, "=")
+			if name = strings.TrimSpace(strings.SplitN(name, "[", 2)[0]); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// durationLimits devuelve -min-duration y -max-duration en segundos (0 = sin límite)
+func durationLimits(opts ConversionOptions) (minDuration, maxDuration float64, err error) {
+	if minDuration, err = parseTimestamp(opts.MinDuration); err != nil {
+		return 0, 0, fmt.Errorf("-min-duration: %w", err)
+	}
+	if maxDuration, err = parseTimestamp(opts.MaxDuration); err != nil {
+		return 0, 0, fmt.Errorf("-max-duration: %w", err)
+	}
+	return minDuration, maxDuration, nil
+}
+
+// durationSkipReason explica por qué un original de duration segundos queda
+// fuera de -min-duration/-max-duration, o devuelve "" si se debe convertir
+func durationSkipReason(duration float64, opts ConversionOptions) string {
+	minDuration, maxDuration, _ := durationLimits(opts)
+	switch {
+	case maxDuration > 0 && duration > maxDuration:
+		return fmt.Sprintf("dura %.2f segundos, más que -max-duration (%s)", duration, opts.MaxDuration)
+	case minDuration > 0 && duration < minDuration:
+		return fmt.Sprintf("dura %.2f segundos, menos que -min-duration (%s)", duration, opts.MinDuration)
+	}
+	return ""
+}
+
+// Límites de -speed: más allá el resultado es una imagen fija o un puñado de cuadros
+const (
+	minSpeed = 0.1
+	maxSpeed = 100.0
+)
+
+// changesSpeed indica si -speed acelera o frena la salida
+func changesSpeed(opts ConversionOptions) bool {
+	return opts.Speed > 0 && opts.Speed != 1
+}
+
+// atempoFilters cambia la velocidad del audio sin alterar el tono. atempo solo
+// acepta factores entre 0.5 y 2 en las versiones de ffmpeg anteriores a la 4.3,
+// así que los factores mayores o menores se reparten en una cadena de filtros
+// cuyo producto es speed
+func atempoFilters(speed float64) []string {
+	var filters []string
+	for speed > 2 {
+		filters = append(filters, "atempo=2")
+		speed /= 2
+	}
+	for speed < 0.5 {
+		filters = append(filters, "atempo=0.5")
+		speed /= 0.5
+	}
+	// Redondear evita factores como 0.7999999999999999 por el error de las divisiones
+	if speed = math.Round(speed*1e6) / 1e6; speed != 1 {
+		filters = append(filters, "atempo="+strconv.FormatFloat(speed, 'f', -1, 64))
+	}
+	return filters
+}
+
+// fadeFilters arma los fundidos de entrada y salida con el filtro name (fade para
+// el video, afade para el audio). El de salida termina justo al final de una
+// salida de duration segundos
+func fadeFilters(name string, fadeIn, fadeOut, duration float64) []string {
+	var filters []string
+	if fadeIn > 0 {
+		filters = append(filters, fmt.Sprintf("%s=t=in:st=0:d=%s", name, strconv.FormatFloat(fadeIn, 'f', -1, 64)))
+	}
+	if fadeOut > 0 {
+		filters = append(filters, fmt.Sprintf("%s=t=out:st=%.3f:d=%s", name, duration-fadeOut, strconv.FormatFloat(fadeOut, 'f', -1, 64)))
+	}
+	return filters
+}
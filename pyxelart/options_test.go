@@ -0,0 +1,192 @@
+package pyxelart
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestQualityToBitrate(t *testing.T) {
+	tests := []struct {
+		quality int
+		want    int
+	}{
+		{0, 100},
+		{29, 486},
+		{30, 500},
+		{69, 1962},
+		{70, 2000},
+		{100, 6000},
+	}
+	for _, tt := range tests {
+		if got := qualityToBitrate(tt.quality); got != tt.want {
+			t.Errorf("qualityToBitrate(%d) = %d, se esperaba %d", tt.quality, got, tt.want)
+		}
+	}
+}
+
+func TestQualityToBitrateIsMonotonic(t *testing.T) {
+	prev := qualityToBitrate(0)
+	for q := 1; q <= 100; q++ {
+		got := qualityToBitrate(q)
+		if got < prev {
+			t.Errorf("qualityToBitrate(%d) = %d es menor que en %d (%d)", q, got, q-1, prev)
+		}
+		prev = got
+	}
+}
+
+func TestTargetBitrate(t *testing.T) {
+	// 8 MB en 60 segundos con 96 kbps de audio
+	got, warning, err := targetBitrate(8<<20, 60, 96)
+	if err != nil || warning != "" {
+		t.Fatalf("targetBitrate: %d, %q, %v", got, warning, err)
+	}
+	if got != 1000 {
+		t.Errorf("targetBitrate(8MB, 60s, 96k) = %d, se esperaba 1000", got)
+	}
+
+	got, warning, err = targetBitrate(100<<10, 600, 96)
+	if err != nil || got != minTargetKbps || warning == "" {
+		t.Errorf("con un objetivo inalcanzable se esperaba %d kbps y una advertencia: %d, %q, %v", minTargetKbps, got, warning, err)
+	}
+
+	if _, _, err := targetBitrate(8<<20, 0, 96); err == nil {
+		t.Error("sin duración se esperaba un error")
+	}
+}
+
+func TestEscapeFilterPath(t *testing.T) {
+	tests := map[string]string{
+		"subs.srt":            "subs.srt",
+		"/videos/my clip.srt": "/videos/my clip.srt",
+		"C:/subs/a.srt":       `C\\:/subs/a.srt`,
+		"it's.srt":            `it\\\'s.srt`,
+		"[final], v2; ok.ass": `\[final\]\, v2\; ok.ass`,
+		`back\slash.srt`:      `back\\\\slash.srt`,
+	}
+	for path, want := range tests {
+		if got := escapeFilterPath(path); got != want {
+			t.Errorf("escapeFilterPath(%q) = %q, se esperaba %q", path, got, want)
+		}
+	}
+}
+
+func TestParseSubtitles(t *testing.T) {
+	if path, index, err := parseSubtitles("subs/es.SRT"); err != nil || path != "subs/es.SRT" || index != -1 {
+		t.Errorf("parseSubtitles(subs/es.SRT) = %q, %d, %v", path, index, err)
+	}
+	if path, index, err := parseSubtitles("embedded:2"); err != nil || path != "" || index != 2 {
+		t.Errorf("parseSubtitles(embedded:2) = %q, %d, %v", path, index, err)
+	}
+	for _, spec := range []string{"embedded:-1", "embedded:x", "subs.txt"} {
+		if _, _, err := parseSubtitles(spec); err == nil {
+			t.Errorf("parseSubtitles(%q): se esperaba un error", spec)
+		}
+	}
+}
+
+func TestStreamLoopCount(t *testing.T) {
+	tests := []struct {
+		duration, target float64
+		want             int
+	}{
+		{5, 60, 11},
+		{5, 62, 12},
+		{7, 60, 8},
+		{60, 60, 0},
+		{90, 60, 0},
+		{0, 60, 0},
+	}
+	for _, tt := range tests {
+		if got := streamLoopCount(tt.duration, tt.target); got != tt.want {
+			t.Errorf("streamLoopCount(%v, %v) = %d, se esperaba %d", tt.duration, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestAtempoFilters(t *testing.T) {
+	tests := []struct {
+		speed float64
+		want  string
+	}{
+		{1.5, "atempo=1.5"},
+		{2, "atempo=2"},
+		{0.5, "atempo=0.5"},
+		{3, "atempo=2,atempo=1.5"},
+		{8, "atempo=2,atempo=2,atempo=2"},
+		{0.3, "atempo=0.5,atempo=0.6"},
+		{0.1, "atempo=0.5,atempo=0.5,atempo=0.5,atempo=0.8"},
+		{1, ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(atempoFilters(tt.speed), ","); got != tt.want {
+			t.Errorf("atempoFilters(%v) = %q, se esperaba %q", tt.speed, got, tt.want)
+		}
+	}
+}
+
+func TestParseDuotone(t *testing.T) {
+	shadows, highlights, err := parseDuotone("#1b1b3a, #FFFFFF")
+	if err != nil || shadows != [3]int{0x1b, 0x1b, 0x3a} || highlights != [3]int{255, 255, 255} {
+		t.Errorf("parseDuotone = %v, %v, %v", shadows, highlights, err)
+	}
+	for _, spec := range []string{"#000000", "#000000,#fff", "black,white", "#000000,#ffffff,#ff0000"} {
+		if _, _, err := parseDuotone(spec); err == nil {
+			t.Errorf("parseDuotone(%q): se esperaba un error", spec)
+		}
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		set   func(opts *ConversionOptions)
+		valid bool
+	}{
+		{"por defecto", func(opts *ConversionOptions) {}, true},
+		{"dither con paleta", func(opts *ConversionOptions) { opts.Dither, opts.PaletteColors = "bayer", 8 }, true},
+		{"dither sin paleta", func(opts *ConversionOptions) { opts.Dither = "bayer" }, false},
+		{"min-duration mayor que max-duration", func(opts *ConversionOptions) { opts.MinDuration, opts.MaxDuration = "60", "30" }, false},
+		{"watermark-pos desconocida", func(opts *ConversionOptions) { opts.Watermark, opts.WatermarkPos = "logo.png", "middle" }, false},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		tt.set(&opts)
+		if err := ValidateOptions(opts); (err == nil) != tt.valid {
+			t.Errorf("%s: ValidateOptions = %v", tt.name, err)
+		}
+	}
+}
+
+func TestProgressReporter(t *testing.T) {
+	var out bytes.Buffer
+	reporter := &progressReporter{out: &out, event: ProgressEvent{Input: "clip.mp4", Duration: 8}}
+	// Los bloques pueden llegar partidos en varias escrituras
+	for _, chunk := range []string{
+		"frame=N/A\nfps=0.00\nout_time_us=N/A\nspeed=N/A\nprogress=continue\n",
+		"frame=60\nfps=30.00\nout_ti", "me_us=2000000\nspeed=1.25x\nprogress=continue\n",
+		"frame=240\nfps=30.00\nout_time_us=8000000\nspeed=1.3x\nprogress=end\n",
+	} {
+		reporter.Write([]byte(chunk))
+	}
+
+	var events []ProgressEvent
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var event ProgressEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("línea inválida %q: %v", line, err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 3 {
+		t.Fatalf("se esperaban 3 eventos, hubo %d: %s", len(events), out.String())
+	}
+	if e := events[1]; e.Percent != 25 || e.Time != 2 || e.Frame != 60 || e.Speed != 1.25 || e.Done {
+		t.Errorf("evento intermedio = %+v", e)
+	}
+	if e := events[2]; e.Percent != 100 || !e.Done || e.Input != "clip.mp4" {
+		t.Errorf("evento final = %+v", e)
+	}
+}
@@ -0,0 +1,262 @@
+package pyxelart
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Lista de encoders de cada binario de ffmpeg, consultada una sola vez
+var (
+	encodersMu   sync.Mutex
+	encodersList = make(map[string]string)
+)
+
+// hasEncoder indica si la instalación de ffmpeg incluye el encoder indicado. Con
+// un CommandRunner propio se consulta siempre, sin guardar el resultado
+func hasEncoder(opts ConversionOptions, name string) bool {
+	encodersMu.Lock()
+	list, ok := encodersList[opts.ffmpeg()]
+	if !ok || opts.runner != nil {
+		output, _ := opts.run().Output(context.Background(), opts.ffmpeg(), "-hide_banner", "-encoders")
+		list = string(output)
+		if opts.runner == nil {
+			encodersList[opts.ffmpeg()] = list
+		}
+	}
+	encodersMu.Unlock()
+	return strings.Contains(list, " "+name+" ")
+}
+
+// hasAlphaChannel indica si un formato de píxel de ffmpeg incluye canal alfa
+func hasAlphaChannel(pixFmt string) bool {
+	for _, prefix := range []string{"yuva", "rgba", "bgra", "argb", "abgr", "gbrap", "ya8", "ya16"} {
+		if strings.HasPrefix(pixFmt, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetVideoInfo obtiene información del video usando ffprobe
+func GetVideoInfo(ctx context.Context, videoPath string) (*VideoInfo, error) {
+	return probeVideo(ctx, ExecRunner{}, FFprobeBin, videoPath)
+}
+
+// probeVideo analiza el video con el binario de ffprobe indicado
+func probeVideo(ctx context.Context, runner CommandRunner, ffprobe, videoPath string) (*VideoInfo, error) {
+	// Obtener dimensiones y duración
+	output, err := runner.Output(ctx,
+		ffprobe, "-v", "error", "-select_streams", "v:0",
+		"-show_entries", "stream=width,height,duration",
+		"-of", "csv=p=0", videoPath,
+	)
+	if err != nil {
+		return nil, classify(ErrProbeFailed, fmt.Errorf("error al ejecutar ffprobe: %w", err))
+	}
+
+	parts := strings.Split(strings.TrimSpace(string(output)), ",")
+	if len(parts) < 3 {
+		return nil, classify(ErrProbeFailed, errors.New("la salida de ffprobe no contiene suficiente información"))
+	}
+
+	width, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, classify(ErrProbeFailed, fmt.Errorf("error al convertir ancho: %w", err))
+	}
+
+	height, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, classify(ErrProbeFailed, fmt.Errorf("error al convertir alto: %w", err))
+	}
+
+	duration, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		duration = 0
+	}
+
+	// Verificar si tiene audio
+	audioOutput, _ := runner.Output(ctx,
+		ffprobe, "-v", "error", "-select_streams", "a",
+		"-show_entries", "stream=codec_type", "-of", "csv=p=0",
+		videoPath,
+	)
+	hasAudio := len(strings.TrimSpace(string(audioOutput))) > 0
+
+	// Contar las pistas de subtítulos (una línea por pista)
+	subtitleOutput, _ := runner.Output(ctx,
+		ffprobe, "-v", "error", "-select_streams", "s",
+		"-show_entries", "stream=codec_type", "-of", "csv=p=0",
+		videoPath,
+	)
+	subtitleStreams := len(strings.Fields(string(subtitleOutput)))
+
+	// Marcas de capítulo (opcionales, como los metadatos)
+	var chapterProbe struct {
+		Chapters []struct {
+			StartTime string            `json:"start_time"`
+			EndTime   string            `json:"end_time"`
+			Tags      map[string]string `json:"tags"`
+		} `json:"chapters"`
+	}
+	if chaptersOutput, err := runner.Output(ctx,
+		ffprobe, "-v", "error", "-show_chapters", "-of", "json", videoPath,
+	); err == nil {
+		json.Unmarshal(chaptersOutput, &chapterProbe)
+	}
+	var chapters []Chapter
+	for _, c := range chapterProbe.Chapters {
+		start, _ := strconv.ParseFloat(c.StartTime, 64)
+		end, _ := strconv.ParseFloat(c.EndTime, 64)
+		chapters = append(chapters, Chapter{Title: c.Tags["title"], Start: start, End: end})
+	}
+
+	// Leer metadatos del contenedor, la rotación y los datos del códec del video
+	// (opcionales, un error no impide la conversión)
+	tagsOutput, tagsErr := runner.Output(ctx,
+		ffprobe, "-v", "error", "-select_streams", "v:0",
+		"-show_entries", "format=size,bit_rate:format_tags:stream=codec_name,avg_frame_rate,bit_rate,pix_fmt,field_order,"+
+			"color_transfer,color_primaries,color_space"+
+			":stream_tags=rotate,alpha_mode:stream_side_data=rotation",
+		"-of", "json", videoPath,
+	)
+
+	var probe struct {
+		Streams []struct {
+			CodecName    string `json:"codec_name"`
+			AvgFrameRate string `json:"avg_frame_rate"`
+			BitRate      string `json:"bit_rate"`
+			PixFmt       string `json:"pix_fmt"`
+			FieldOrder   string `json:"field_order"`
+			Transfer     string `json:"color_transfer"`
+			Primaries    string `json:"color_primaries"`
+			ColorSpace   string `json:"color_space"`
+			Tags         struct {
+				Rotate    string `json:"rotate"`
+				AlphaMode string `json:"alpha_mode"`
+			} `json:"tags"`
+			SideData []struct {
+				Rotation float64 `json:"rotation"`
+			} `json:"side_data_list"`
+		} `json:"streams"`
+		Format struct {
+			Size    string            `json:"size"`
+			BitRate string            `json:"bit_rate"`
+			Tags    map[string]string `json:"tags"`
+		} `json:"format"`
+	}
+	if tagsErr == nil {
+		json.Unmarshal(tagsOutput, &probe)
+	}
+
+	// La rotación puede venir como etiqueta "rotate" (giro horario, archivos
+	// viejos) o en la matriz de visualización (giro antihorario)
+	rotation := 0
+	var codec, pixFmt, fieldOrder, transfer, primaries, colorSpace string
+	var fps float64
+	hasAlpha := false
+	bitrate, _ := strconv.ParseInt(probe.Format.BitRate, 10, 64)
+	size, _ := strconv.ParseInt(probe.Format.Size, 10, 64)
+	if len(probe.Streams) > 0 {
+		stream := probe.Streams[0]
+		codec = stream.CodecName
+		fps = parseFrameRate(stream.AvgFrameRate)
+		pixFmt = stream.PixFmt
+		fieldOrder = stream.FieldOrder
+		transfer, primaries, colorSpace = stream.Transfer, stream.Primaries, stream.ColorSpace
+		// En WebM el decodificador nativo de VP8/VP9 informa yuv420p aunque el
+		// archivo tenga alfa: eso solo se ve en la etiqueta alpha_mode
+		hasAlpha = hasAlphaChannel(pixFmt) || stream.Tags.AlphaMode == "1"
+		// WebM/MKV no suelen informar el bitrate del stream: queda el del contenedor
+		if streamBitrate, err := strconv.ParseInt(stream.BitRate, 10, 64); err == nil && streamBitrate > 0 {
+			bitrate = streamBitrate
+		}
+		if degrees, err := strconv.Atoi(stream.Tags.Rotate); err == nil {
+			rotation = degrees
+		}
+		for _, side := range stream.SideData {
+			if side.Rotation != 0 {
+				rotation = -int(side.Rotation)
+			}
+		}
+	}
+	rotation = ((rotation % 360) + 360) % 360
+
+	return &VideoInfo{
+		Width:    width,
+		Height:   height,
+		Duration: duration,
+		HasAudio: hasAudio,
+		Tags:     probe.Format.Tags,
+		Rotation: rotation,
+		Codec:    codec,
+		FPS:      fps,
+		Bitrate:  bitrate,
+		Size:     size,
+		PixFmt:   pixFmt,
+		HasAlpha: hasAlpha,
+
+		FieldOrder: fieldOrder,
+
+		ColorTransfer:  transfer,
+		ColorPrimaries: primaries,
+		ColorSpace:     colorSpace,
+
+		SubtitleStreams: subtitleStreams,
+		Chapters:        chapters,
+	}, nil
+}
+
+// parseFrameRate interpreta una tasa de cuadros de ffprobe ("30000/1001", "25/1");
+// devuelve 0 si no está disponible ("0/0")
+func parseFrameRate(rate string) float64 {
+	num, den, found := strings.Cut(rate, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !found {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// CheckDependencies verifica que ffmpeg y ffprobe estén instalados y, en modo
+// verbose, muestra sus versiones
+func CheckDependencies(verbose bool) error {
+	var missing []string
+	for _, tool := range []string{FFmpegBin, FFprobeBin} {
+		path, err := exec.LookPath(tool)
+		if err != nil {
+			missing = append(missing, tool)
+			continue
+		}
+
+		if verbose {
+			output, err := exec.Command(path, "-version").Output()
+			version := "versión desconocida"
+			if err == nil {
+				version = strings.TrimSpace(strings.SplitN(string(output), "\n", 2)[0])
+			}
+			Infof("%s: %s (%s)\n", filepath.Base(tool), version, path)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("no se encontró %s en el PATH. Instala FFmpeg:\n"+
+			"  - Linux: sudo apt-get install ffmpeg\n"+
+			"  - macOS: brew install ffmpeg\n"+
+			"  - Windows: https://ffmpeg.org/download.html", strings.Join(missing, " ni "))
+	}
+	return nil
+}
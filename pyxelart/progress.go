@@ -0,0 +1,94 @@
+package pyxelart
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ProgressEvent es un evento de -json-progress: una línea JSON por cada reporte
+// de ffmpeg, pensada para que una interfaz gráfica dibuje su propio progreso
+type ProgressEvent struct {
+	Input    string  `json:"input"`
+	Pass     int     `json:"pass,omitempty"` // Pasada actual con -two-pass
+	Percent  float64 `json:"percent"`        // 0 si no se conoce la duración
+	Time     float64 `json:"time_seconds"`
+	Duration float64 `json:"duration_seconds,omitempty"`
+	Frame    int     `json:"frame"`
+	FPS      float64 `json:"fps"`
+	Speed    float64 `json:"speed"` // Múltiplo del tiempo real (1.5 = 1.5x)
+	Done     bool    `json:"done"`
+}
+
+// progressMu serializa los eventos de los trabajadores que comparten el destino
+var progressMu sync.Mutex
+
+// progressReporter recibe la salida de "ffmpeg -progress pipe:1" (bloques de
+// líneas clave=valor que terminan en progress=continue o progress=end) y
+// escribe un ProgressEvent por bloque en out
+type progressReporter struct {
+	out   io.Writer
+	event ProgressEvent
+	buf   []byte
+}
+
+func (p *progressReporter) Write(data []byte) (int, error) {
+	p.buf = append(p.buf, data...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(data), nil
+		}
+		key, value, _ := strings.Cut(strings.TrimSpace(string(p.buf[:i])), "=")
+		p.buf = p.buf[i+1:]
+		p.parse(key, value)
+	}
+}
+
+// parse incorpora un par clave=valor al evento en curso. Los valores N/A que
+// ffmpeg informa al empezar se ignoran
+func (p *progressReporter) parse(key, value string) {
+	switch key {
+	case "frame":
+		if frame, err := strconv.Atoi(value); err == nil {
+			p.event.Frame = frame
+		}
+	case "fps":
+		if fps, err := strconv.ParseFloat(value, 64); err == nil {
+			p.event.FPS = fps
+		}
+	case "out_time_us":
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+			p.event.Time = float64(us) / 1e6
+		}
+	case "speed":
+		if speed, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "x"), 64); err == nil {
+			p.event.Speed = speed
+		}
+	case "progress":
+		p.event.Done = value == "end"
+		p.emit()
+	}
+}
+
+// emit escribe el evento en curso como una línea JSON
+func (p *progressReporter) emit() {
+	event := p.event
+	if event.Duration > 0 {
+		event.Percent = min(100, math.Round(event.Time/event.Duration*1000)/10)
+		if event.Done {
+			event.Percent = 100
+		}
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	p.out.Write(append(line, '\n'))
+}
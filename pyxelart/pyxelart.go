@@ -0,0 +1,433 @@
+// Package pyxelart convierte videos a WebM, MP4 o GIF con ffmpeg, de a uno o
+// por lotes, y obtiene su información con ffprobe
+package pyxelart
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// VideoInfo almacena información sobre un archivo de video
+type VideoInfo struct {
+	Width    int               `json:"width"`
+	Height   int               `json:"height"`
+	Duration float64           `json:"duration_seconds"`
+	HasAudio bool              `json:"has_audio"`
+	Tags     map[string]string `json:"tags,omitempty"` // Metadatos del contenedor (title, artist, comment, ...)
+	Rotation int               `json:"rotation"`       // Giro horario necesario para verlo derecho (0, 90, 180 o 270)
+	Codec    string            `json:"codec"`          // Códec de video del original (h264, vp9, ...)
+	FPS      float64           `json:"fps"`            // Tasa de cuadros promedio (0 si no se pudo determinar)
+	Bitrate  int64             `json:"bitrate"`        // Bitrate en bits por segundo (del stream o, si falta, del contenedor)
+	Size     int64             `json:"size_bytes"`     // Tamaño del archivo según el contenedor
+	PixFmt   string            `json:"pix_fmt"`        // Formato de píxel del video (yuv420p, yuva420p, ...)
+	HasAlpha bool              `json:"has_alpha"`      // El video tiene canal alfa (transparencia)
+
+	// Orden de los campos según ffprobe: progressive, tt, bb, tb o bt (entrelazado)
+	// o vacío/unknown si el contenedor no lo indica
+	FieldOrder string `json:"field_order,omitempty"`
+
+	// Metadatos de color del video según ffprobe (vacíos si no se indican)
+	ColorTransfer  string `json:"color_transfer,omitempty"`  // smpte2084 (PQ) o arib-std-b67 (HLG) en HDR
+	ColorPrimaries string `json:"color_primaries,omitempty"` // bt709, bt2020, ...
+	ColorSpace     string `json:"color_space,omitempty"`     // Matriz: bt709, bt2020nc, ...
+
+	SubtitleStreams int       `json:"subtitle_streams"`   // Cantidad de pistas de subtítulos incrustadas
+	Chapters        []Chapter `json:"chapters,omitempty"` // Marcas de capítulo, en orden
+}
+
+// HDR indica si la función de transferencia del video es de alto rango dinámico
+func (info *VideoInfo) HDR() bool {
+	return info.ColorTransfer == "smpte2084" || info.ColorTransfer == "arib-std-b67"
+}
+
+// Interlaced indica si ffprobe informa que el video está entrelazado
+func (info *VideoInfo) Interlaced() bool {
+	switch info.FieldOrder {
+	case "tt", "bb", "tb", "bt":
+		return true
+	}
+	return false
+}
+
+// ConversionOptions almacena opciones para convertir un video
+type ConversionOptions struct {
+	Quality int
+	CRF     int    // -1 indica que no se usa el modo de calidad constante
+	Bitrate string // Bitrate de video fijo (ej: "1500", "1500k", "2M"); reemplaza al que corresponde a Quality
+
+	// Tamaño objetivo de la salida en bytes (0 = sin objetivo). El bitrate se
+	// calcula a partir de la duración y se codifica en dos pasadas
+	TargetSize int64
+
+	MaxRate   string // Tope de bitrate para VBR restringido (ej: "2M", "1500k"; vacío = sin tope)
+	BufSize   string // Búfer del control de bitrate (vacío = el doble de MaxRate)
+	Codec     string // vp8, vp9 o av1 (vacío equivale a vp9)
+	Alpha     bool   // Conservar la transparencia (yuva420p); solo VP9 en WebM
+	Preset    string // fast, balanced o slow (vacío equivale a balanced)
+	Resize    string
+	NoUpscale bool    // Con Resize, no agrandar videos más chicos que el tamaño pedido
+	Pad       bool    // Con Resize, completar con bandas hasta el tamaño exacto pedido
+	PadColor  string  // Color de las bandas de Pad: nombre de ffmpeg o #RRGGBB (vacío = negro)
+	ScaleAlgo string  // Interpolación de los filtros scale: bilinear, bicubic, lanczos o neighbor (vacío = la de ffmpeg)
+	Scale     float64 // Porcentaje del tamaño original (0 = sin cambios); excluye a Resize
+	Crop      string
+	Rotate    int     // Giro horario adicional: 0, 90, 180 o 270
+	FPS       float64 // 0 mantiene la tasa original; la duración del video no cambia
+
+	// Multiplicador de velocidad de video y audio: 2 = el doble de rápido
+	// (timelapse), 0.5 = cámara lenta. 0 o 1 = sin cambios
+	Speed float64
+
+	// Segundos de fundido desde negro al comienzo y hacia negro al final de la
+	// salida, con fundido del audio en los mismos tramos (0 = sin fundido)
+	FadeIn  float64
+	FadeOut float64
+
+	// Cuadros entre keyframes o "auto" (dos segundos a la tasa de salida). Más
+	// keyframes permiten saltar con precisión, pero agrandan el archivo. Vacío =
+	// lo decide el encoder
+	KeyInt string
+
+	Filters string // Filtergraph propio que se suma a los filtros generados (-vf)
+
+	Autorotate bool // Corregir el giro según los metadatos de rotación del original
+
+	// Desentrelazado con yadif: "frame" (un cuadro por cuadro) o "field" (un cuadro
+	// por campo, duplica los fps); vacío = no. AutoDeinterlace lo aplica en modo
+	// frame solo si ffprobe informa que el original está entrelazado
+	Deinterlace     string
+	AutoDeinterlace bool
+
+	Denoise float64 // Intensidad de hqdn3d (0 desactiva; 4 es un valor moderado)
+	Sharpen float64 // Intensidad de unsharp (0 desactiva; 1 es un valor moderado)
+
+	// Subtítulos a incrustar en la imagen: un archivo .srt/.ass/.ssa/.vtt o
+	// "embedded:N" para la pista de subtítulos N del original (vacío = ninguno)
+	Subtitles string
+
+	// Imagen (por ejemplo un logo PNG con transparencia) a superponer sobre el
+	// video, su posición (topleft, top, topright, left, center, right, bottomleft,
+	// bottom o bottomright; vacío = bottomright) y su opacidad entre 0 y 1 (0 = 1)
+	Watermark        string
+	WatermarkPos     string
+	WatermarkOpacity float64
+
+	StartTime string // Inicio del segmento a convertir: segundos o HH:MM:SS (vacío = desde el comienzo)
+	EndTime   string // Fin del segmento, en el mismo formato (vacío = hasta el final)
+
+	// Convertir solo los primeros N segundos (desde StartTime) para probar la
+	// calidad rápidamente; la salida lleva el sufijo _sample. 0 = todo el video
+	Sample float64
+
+	// Repetir el original hasta alcanzar esta duración (segundos o HH:MM:SS) y
+	// cortar ahí; un original más largo solo se corta. LoopAudio repite también el
+	// audio en lugar de quitarlo
+	LoopTo    string
+	LoopAudio bool
+
+	// Omitir los originales que duran más o menos que esto (segundos o HH:MM:SS;
+	// vacío = sin límite). Protege a un lote de codificar por error un archivo de horas
+	MaxDuration string
+	MinDuration string
+
+	OutputFormat string // webm, mp4 o gif (vacío equivale a webm); gif no lleva audio
+	HWAccel      string // vaapi, nvenc o qsv (vacío = codificación por software); requiere mp4
+
+	Boomerang      bool   // Reproducir el clip hacia adelante y luego al revés (sin audio)
+	PixelateFactor int    // Tamaño del bloque de píxeles (0 desactiva el efecto)
+	PaletteColors  int    // Cantidad de colores de la paleta (0 desactiva la reducción)
+	Dither         string // Algoritmo de tramado de paletteuse (vacío = el de ffmpeg)
+
+	Tonemap   bool   // Convertir los originales HDR a SDR (bt709) para que no se vean lavados
+	Grayscale bool   // Blanco y negro
+	Duotone   string // Dos colores "#sombras,#luces" que reemplazan la escala de grises (vacío = no)
+
+	AudioCodec   string // opus o vorbis (vacío equivale a opus)
+	AudioBitrate string // Por ejemplo "96k" (vacío equivale a 96k)
+	NoAudio      bool   // Elimina el audio aunque el video lo tenga
+
+	NormalizeAudio bool    // Nivelar el volumen con loudnorm
+	LoudnessTarget float64 // Sonoridad integrada objetivo en LUFS (0 equivale a -16)
+
+	StripMetadata bool // Descarta los metadatos del original en lugar de copiarlos
+
+	// Nombre de la salida con marcadores (ej: "{name}_{width}x{height}_q{quality}");
+	// si no tiene extensión se agrega la del formato. Vacío = nombre en snake_case
+	OutputTemplate string
+
+	KeepName     bool // Conservar el nombre original en lugar de pasarlo a snake_case
+	Overwrite    bool // Reconvertir aunque la salida exista y esté actualizada
+	SkipExisting bool // Omitir si la salida ya existe, sin comparar fechas
+	DeleteSource bool // Eliminar el original si la salida generada pasa una verificación básica
+
+	Verify        bool // Comprobar con ffprobe la pista de video y la duración de la salida
+	RemoveInvalid bool // Eliminar la salida que no pasa la verificación
+
+	Thumbnail       bool   // Generar una imagen de vista previa junto al video
+	ThumbnailTime   string // Segundos ("3.5") o porcentaje de la duración ("10%")
+	ThumbnailFormat string // jpg, png o webp (vacío equivale a jpg)
+
+	// Generar la miniatura como segunda salida de la misma ejecución de ffmpeg,
+	// sin volver a decodificar; si falla se genera por separado
+	TwoOutput bool
+
+	// Argumentos adicionales para ffmpeg, sin validar, que se agregan justo antes
+	// del archivo de salida. Son una vía de escape para opciones no expuestas
+	ExtraArgs []string
+
+	// Ajustes avanzados de libvpx-vp9; -1 deja el valor por defecto del encoder
+	LagInFrames   int // Cuadros que el encoder mira hacia adelante (0-25)
+	AutoAltRef    int // Cuadros de referencia alternativos (0-6)
+	ArnrMaxFrames int // Cuadros del filtro de reducción de ruido temporal (0-15)
+
+	Threads  int           // Hilos de ffmpeg (0 = automático según los núcleos disponibles)
+	RowMT    bool          // Multihilo por filas en VP9 (-row-mt), solo con más de un hilo
+	Timeout  time.Duration // Tiempo máximo por archivo (0 = sin límite)
+	MinFree  int64         // Bytes que deben quedar libres en el disco después de la salida estimada
+	TmpDir   string        // Directorio de los archivos a medio escribir (vacío = junto a la salida)
+	Retries  int           // Reintentos si ffmpeg termina con error (0 = ninguno)
+	TwoPass  bool
+	DryRun   bool
+	Progress bool // Muestra una barra de progreso mientras ffmpeg trabaja
+	JSON     bool // Salida en formato JSON, sin mensajes decorativos
+	Verbose  bool
+
+	// Destino de los eventos de progreso en JSON, uno por línea (ver
+	// ProgressEvent); nil los desactiva. Puede compartirse entre trabajadores
+	ProgressJSON io.Writer
+
+	// Binarios a usar en lugar de FFmpegBin/FFprobeBin y cómo ejecutarlos; los
+	// define Converter
+	ffmpegPath  string
+	ffprobePath string
+	runner      CommandRunner
+
+	// Lista de archivos a unir con el demuxer concat; la define ConcatVideos
+	concat *concatInput
+
+	// Original que identifica a los eventos de ProgressJSON; lo define ConvertVideo
+	progressInput string
+}
+
+// run devuelve el CommandRunner para estas opciones
+func (opts ConversionOptions) run() CommandRunner {
+	if opts.runner != nil {
+		return opts.runner
+	}
+	return ExecRunner{}
+}
+
+// ffmpeg devuelve el binario de ffmpeg para estas opciones
+func (opts ConversionOptions) ffmpeg() string {
+	if opts.ffmpegPath != "" {
+		return opts.ffmpegPath
+	}
+	return FFmpegBin
+}
+
+// ffprobe devuelve el binario de ffprobe para estas opciones
+func (opts ConversionOptions) ffprobe() string {
+	if opts.ffprobePath != "" {
+		return opts.ffprobePath
+	}
+	return FFprobeBin
+}
+
+// DirectoryOptions almacena opciones para procesar un directorio completo
+type DirectoryOptions struct {
+	Recursive  bool // Buscar videos en subdirectorios
+	MaxWorkers int  // Número máximo de conversiones en paralelo
+	SkipWebm   bool // Excluir los .webm de entrada para no volver a comprimirlos
+	Flatten    bool // Dejar todas las salidas en outputDir en lugar de replicar los subdirectorios
+
+	// Qué hacer si dos originales generan la misma salida: "suffix" (por defecto)
+	// agrega un sufijo numérico y "error" cancela el lote antes de empezar
+	OnCollision string
+
+	// Orden de las conversiones: name, size, size-desc o mtime (ver SortOrders;
+	// vacío = el orden en que se encontraron los archivos)
+	Sort string
+
+	Limit int // Convertir solo los primeros N videos, ya ordenados (0 = todos)
+
+	// Procesar los videos en orden aleatorio, por ejemplo para revisar con Limit
+	// una muestra representativa. Seed fija la mezcla para repetirla (0 = al azar)
+	Shuffle bool
+	Seed    int64
+
+	Extensions      []string // Reemplaza las extensiones de video por defecto
+	ExtraExtensions []string // Se agregan a las extensiones por defecto (o a Extensions)
+
+	// Patrones glob que se comparan con la ruta relativa y con el nombre del archivo
+	Include []string // Si hay alguno, solo se procesan los archivos que coinciden
+	Exclude []string // Archivos a ignorar aunque coincidan con Include
+
+	MinSize int64 // Tamaño mínimo en bytes (0 = sin límite)
+	MaxSize int64 // Tamaño máximo en bytes (0 = sin límite)
+
+	FailFast bool // Cancelar todo el lote ante el primer error
+
+	Watch         bool          // Después de la primera pasada, seguir convirtiendo los videos nuevos
+	WatchInterval time.Duration // Cada cuánto revisar el directorio con Watch (0 = DefaultWatchInterval)
+
+	// Archivo de estado con los originales ya convertidos: se omiten en las
+	// siguientes ejecuciones mientras no cambien su tamaño ni su fecha
+	Resume string
+
+	// Al cerrarse deja de tomar archivos nuevos, pero las conversiones en curso
+	// terminan normalmente (Ctrl-C en main); nil si no se usa
+	Drain <-chan struct{}
+}
+
+// ConversionResult almacena el resultado de convertir un video
+type ConversionResult struct {
+	InputPath         string        `json:"input"`
+	OutputPath        string        `json:"output"`
+	InputSizeBytes    int64         `json:"input_size_bytes"`
+	OutputSizeBytes   int64         `json:"output_size_bytes"`
+	Ratio             float64       `json:"ratio"` // Porcentaje del tamaño original
+	Elapsed           time.Duration `json:"-"`
+	Success           bool          `json:"success"`
+	Skipped           bool          `json:"skipped,omitempty"`
+	SkipReason        string        `json:"skip_reason,omitempty"` // Por qué se omitió, si no fue porque la salida ya existía
+	SkippedByDuration bool          `json:"skipped_by_duration,omitempty"`
+	Error             string        `json:"error,omitempty"`
+	ThumbnailPath     string        `json:"thumbnail,omitempty"`
+	FinishedAt        time.Time     `json:"-"`
+	Commands          []string      `json:"commands,omitempty"` // Comandos de ffmpeg ejecutados (o planificados)
+	Width             int           `json:"width,omitempty"`    // Dimensiones reales del archivo generado
+	Height            int           `json:"height,omitempty"`
+	Attempts          int           `json:"attempts,omitempty"`                 // Intentos de codificación realizados
+	TrimmedDuration   float64       `json:"trimmed_duration_seconds,omitempty"` // Duración del segmento con -start/-end
+	Warnings          []string      `json:"warnings,omitempty"`                 // Avisos que no impidieron la conversión
+	SourceDeleted     bool          `json:"source_deleted,omitempty"`           // El original se eliminó con -delete-source
+	OutputDuration    float64       `json:"output_duration_seconds,omitempty"`  // Duración del archivo generado
+	VerifyError       string        `json:"verify_error,omitempty"`             // Motivo por el que la salida no pasó -verify
+}
+
+// MarshalJSON expresa la duración de la conversión en segundos
+func (result ConversionResult) MarshalJSON() ([]byte, error) {
+	type alias ConversionResult
+	return json.Marshal(struct {
+		alias
+		DurationSeconds float64 `json:"duration_seconds"`
+	}{alias(result), result.Elapsed.Seconds()})
+}
+
+// ConversionStats almacena estadísticas de la conversión por lotes
+type ConversionStats struct {
+	Total   int
+	Exito   int
+	Error   int
+	Results []ConversionResult
+
+	TotalInputBytes  int64 // Tamaño sumado de los originales convertidos
+	TotalOutputBytes int64 // Tamaño sumado de los archivos generados
+
+	SkippedBySize     int  // Archivos descartados por -min-size/-max-size
+	SkippedByDuration int  // Archivos omitidos por -min-duration/-max-duration
+	Aborted           bool // El lote se detuvo en el primer error (-fail-fast)
+	Pending           int  // Archivos que quedaron sin procesar al interrumpir el lote
+
+	mu sync.Mutex
+}
+
+// Método para acumular los tamaños de una conversión de forma segura
+func (stats *ConversionStats) sumarBytes(inputBytes, outputBytes int64) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.TotalInputBytes += inputBytes
+	stats.TotalOutputBytes += outputBytes
+}
+
+// SavedBytes devuelve cuántos bytes se ahorraron en total
+func (stats *ConversionStats) SavedBytes() int64 {
+	return stats.TotalInputBytes - stats.TotalOutputBytes
+}
+
+// Método para registrar el resultado de un archivo de forma segura
+func (stats *ConversionStats) agregarResultado(result ConversionResult) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if result.FinishedAt.IsZero() {
+		result.FinishedAt = time.Now()
+	}
+	stats.Results = append(stats.Results, result)
+	// Un archivo rechazado por su duración no es una conversión exitosa
+	if result.SkippedByDuration {
+		stats.SkippedByDuration++
+		return
+	}
+	if result.Success {
+		stats.Exito++
+	} else {
+		stats.Error++
+	}
+}
+
+// Binarios usados para convertir y analizar videos. Se pueden reemplazar con
+// -ffmpeg-path/-ffprobe-path o con las variables de entorno FFMPEG_BIN y FFPROBE_BIN
+var (
+	FFmpegBin  = "ffmpeg"
+	FFprobeBin = "ffprobe"
+)
+
+// logLevel indica cuánto se muestra en la consola
+type logLevel int
+
+const (
+	levelQuiet   logLevel = iota // Solo errores
+	levelNormal                  // Progreso y resultados de cada archivo
+	levelVerbose                 // Además, comandos y salida completa de ffmpeg
+)
+
+// outputLevel es el nivel de mensajes elegido con -quiet/-verbose
+var outputLevel = levelNormal
+
+// logOutput es donde se escriben los mensajes
+var logOutput io.Writer = os.Stdout
+
+// SetLogOutput cambia dónde se escriben los mensajes (por defecto la salida
+// estándar). Con la salida de video en stdout deben ir a stderr
+func SetLogOutput(w io.Writer) {
+	logOutput = w
+}
+
+// ConfigureLogging fija el nivel de mensajes según las opciones de la línea de comandos
+func ConfigureLogging(quiet, verbose bool) error {
+	switch {
+	case quiet && verbose:
+		return errors.New("-quiet y -verbose no se pueden usar juntos")
+	case quiet:
+		outputLevel = levelQuiet
+	case verbose:
+		outputLevel = levelVerbose
+	default:
+		outputLevel = levelNormal
+	}
+	return nil
+}
+
+// Infof muestra un mensaje informativo (se omite con -quiet)
+func Infof(format string, args ...any) {
+	if outputLevel >= levelNormal {
+		fmt.Fprintf(logOutput, format, args...)
+	}
+}
+
+// verbosef muestra un mensaje de detalle (solo con -verbose)
+func verbosef(format string, args ...any) {
+	if outputLevel >= levelVerbose {
+		fmt.Fprintf(logOutput, format, args...)
+	}
+}
+
+// errorf muestra un error; se muestra siempre, incluso con -quiet
+func errorf(format string, args ...any) {
+	fmt.Fprintf(logOutput, format, args...)
+}
@@ -0,0 +1,35 @@
+package pyxelart
+
+import (
+	"context"
+	"io"
+	"os/exec"
+)
+
+// CommandRunner ejecuta ffmpeg y ffprobe. Reemplazarlo (ver Converter.Runner)
+// permite probar la conversión sin tener ffmpeg instalado
+type CommandRunner interface {
+	// Run ejecuta el comando enviando su salida a stdout y stderr (nil la descarta)
+	Run(ctx context.Context, name string, args []string, stdout, stderr io.Writer) error
+	// Output ejecuta el comando y devuelve lo que escribió en stdout
+	Output(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// ExecRunner ejecuta los comandos con os/exec
+type ExecRunner struct{}
+
+// Run implementa CommandRunner
+func (ExecRunner) Run(ctx context.Context, name string, args []string, stdout, stderr io.Writer) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	// Al vencer el tiempo límite ffmpeg se mata, pero si algo mantiene abiertas
+	// sus salidas Wait no vuelve: se deja de esperar para liberar al trabajador
+	cmd.WaitDelay = ffmpegWaitDelay
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// Output implementa CommandRunner
+func (ExecRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).Output()
+}
@@ -0,0 +1,100 @@
+package pyxelart
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// mockRunner responde como ffprobe con un video fijo de 1920x1080 y 10 segundos,
+// y registra las ejecuciones de ffmpeg creando el archivo de salida
+type mockRunner struct {
+	mu         sync.Mutex
+	noAudio    bool
+	subtitles  int
+	chapters   string // JSON de -show_chapters
+	fieldOrder string
+	transfer   string // color_transfer del video
+	failRuns   int    // Cantidad de ejecuciones de ffmpeg que fallan antes de la primera que funciona
+	runCalls   [][]string
+}
+
+func (m *mockRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	joined := strings.Join(args, " ")
+	switch {
+	case strings.Contains(joined, "-encoders"):
+		return []byte(" V..... libx264 x\n"), nil
+	case strings.Contains(joined, "-show_chapters"):
+		return []byte(m.chapters), nil
+	case strings.Contains(joined, "-select_streams s"):
+		return []byte(strings.Repeat("subtitle\n", m.subtitles)), nil
+	case strings.Contains(joined, "stream=codec_type"):
+		if m.noAudio {
+			return nil, nil
+		}
+		return []byte("audio\n"), nil
+	case strings.Contains(joined, "-of json"):
+		return []byte(`{"streams":[{"codec_name":"h264","avg_frame_rate":"30/1","pix_fmt":"yuv420p","field_order":"` +
+			m.fieldOrder + `","color_transfer":"` + m.transfer + `"}],"format":{"size":"1048576"}}`), nil
+	}
+	return []byte("1920,1080,10.0\n"), nil
+}
+
+func (m *mockRunner) Run(ctx context.Context, name string, args []string, stdout, stderr io.Writer) error {
+	m.mu.Lock()
+	m.runCalls = append(m.runCalls, args)
+	failed := len(m.runCalls) <= m.failRuns
+	m.mu.Unlock()
+	if failed {
+		return errors.New("ffmpeg terminó con un error")
+	}
+	return os.WriteFile(args[len(args)-1], make([]byte, 1024), 0644)
+}
+
+// writeClip crea un video de prueba en dir; el mock no lee su contenido
+func writeClip(t *testing.T, dir, name string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// convertClip convierte con el mock un video de prueba a clip.webm en un
+// directorio temporal
+func convertClip(t *testing.T, runner *mockRunner, opts ConversionOptions) (ConversionResult, error) {
+	t.Helper()
+	dir := t.TempDir()
+	input := writeClip(t, dir, "clip.mp4")
+	converter := Converter{Options: opts, Runner: runner}
+	return converter.Convert(context.Background(), input, filepath.Join(dir, "clip.webm"))
+}
+
+// convertArgs convierte un video de prueba y devuelve los argumentos de la
+// única ejecución de ffmpeg
+func convertArgs(t *testing.T, runner *mockRunner, opts ConversionOptions) []string {
+	t.Helper()
+	if _, err := convertClip(t, runner, opts); err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	if len(runner.runCalls) != 1 {
+		t.Fatalf("se esperaba una ejecución de ffmpeg, hubo %d", len(runner.runCalls))
+	}
+	return runner.runCalls[0]
+}
+
+// argValue devuelve el valor que sigue a flag en args
+func argValue(args []string, flag string) (string, bool) {
+	i := slices.Index(args, flag)
+	if i < 0 || i+1 >= len(args) {
+		return "", false
+	}
+	return args[i+1], true
+}
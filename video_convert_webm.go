@@ -1,560 +1,1099 @@
 package main
 
 import (
-	"errors"
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"io/fs"
+	"io"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
-	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
+
+	"github.com/elanticrypt0/pyxelart/pyxelart"
 )
 
-// VideoInfo almacena información sobre un archivo de video
-type VideoInfo struct {
-	Width    int
-	Height   int
-	Duration float64
-	HasAudio bool
-}
+// infof muestra un mensaje informativo (se omite con -quiet)
+var infof = pyxelart.Infof
 
-// ConversionOptions almacena opciones para convertir un video
-type ConversionOptions struct {
-	Quality int
-	Resize  string
-	Crop    string
-	Threads int
-	Verbose bool
-}
-
-// ConversionStats almacena estadísticas de la conversión por lotes
-type ConversionStats struct {
-	Total int
-	Exito int
-	Error int
-	mu    sync.Mutex
-}
+// logOutput es donde se escriben los mensajes: stderr cuando el video sale por stdout
+var logOutput io.Writer = os.Stdout
 
-// Método para incrementar estadísticas de forma segura
-func (stats *ConversionStats) incrementarExito() {
-	stats.mu.Lock()
-	defer stats.mu.Unlock()
-	stats.Exito++
+// errorf muestra un error; se muestra siempre, incluso con -quiet
+func errorf(format string, args ...any) {
+	fmt.Fprintf(logOutput, format, args...)
 }
 
-func (stats *ConversionStats) incrementarError() {
-	stats.mu.Lock()
-	defer stats.mu.Unlock()
-	stats.Error++
+// envOrDefault devuelve el valor de la variable de entorno o el valor por defecto
+func envOrDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
 }
 
-// snakeCaseFilename convierte un nombre de archivo a snake_case
-func snakeCaseFilename(filename string) string {
-	base := filepath.Base(filename)
-	ext := filepath.Ext(base)
-	name := strings.TrimSuffix(base, ext)
-
-	// Reemplazar caracteres no alfanuméricos con guiones bajos
-	re := regexp.MustCompile(`[^a-zA-Z0-9]`)
-	name = re.ReplaceAllString(name, "_")
-
-	// Convertir camelCase a snake_case
-	re = regexp.MustCompile(`([a-z0-9])([A-Z])`)
-	name = re.ReplaceAllString(name, "${1}_${2}")
-
-	// Convertir a minúsculas
-	name = strings.ToLower(name)
-
-	// Eliminar guiones bajos múltiples
-	re = regexp.MustCompile(`_+`)
-	name = re.ReplaceAllString(name, "_")
-
-	// Eliminar guiones bajos al inicio o final
-	name = strings.Trim(name, "_")
-
-	return name
+// confirm muestra una pregunta y espera una respuesta afirmativa por la entrada estándar
+func confirm(question string) bool {
+	fmt.Printf("%s [s/N]: ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "s", "si", "sí", "y", "yes":
+		return true
+	}
+	return false
 }
 
-// getVideoInfo obtiene información del video usando ffprobe
-func getVideoInfo(videoPath string) (*VideoInfo, error) {
-	// Obtener dimensiones y duración
-	cmd := exec.Command(
-		"ffprobe", "-v", "error", "-select_streams", "v:0",
-		"-show_entries", "stream=width,height,duration",
-		"-of", "csv=p=0", videoPath,
-	)
-
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("error al ejecutar ffprobe: %w", err)
+// benchCases arma las combinaciones de -presets y -threads; sin hilos usa las
+// cantidades por defecto de pyxelart.DefaultBenchCases
+func benchCases(presets, threads string) ([]pyxelart.BenchCase, error) {
+	var counts []int
+	for _, item := range splitList(threads) {
+		n, err := strconv.Atoi(item)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("cantidad de hilos inválida en -threads: '%s'", item)
+		}
+		counts = append(counts, n)
 	}
-
-	parts := strings.Split(strings.TrimSpace(string(output)), ",")
-	if len(parts) < 3 {
-		return nil, errors.New("la salida de ffprobe no contiene suficiente información")
+	if len(counts) == 0 {
+		for _, c := range pyxelart.DefaultBenchCases() {
+			if !slices.Contains(counts, c.Threads) {
+				counts = append(counts, c.Threads)
+			}
+		}
 	}
 
-	width, err := strconv.Atoi(parts[0])
-	if err != nil {
-		return nil, fmt.Errorf("error al convertir ancho: %w", err)
+	var cases []pyxelart.BenchCase
+	for _, preset := range splitList(presets) {
+		for _, n := range counts {
+			cases = append(cases, pyxelart.BenchCase{Preset: preset, Threads: n})
+		}
 	}
-
-	height, err := strconv.Atoi(parts[1])
-	if err != nil {
-		return nil, fmt.Errorf("error al convertir alto: %w", err)
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("-presets no puede estar vacío")
 	}
+	return cases, nil
+}
 
-	duration, err := strconv.ParseFloat(parts[2], 64)
-	if err != nil {
-		duration = 0
+// printBenchResults muestra la tabla de mediciones y la combinación recomendada
+func printBenchResults(results []pyxelart.BenchResult) {
+	fmt.Printf("\n%-10s %6s %10s %10s %10s\n", "Preset", "Hilos", "Tiempo", "Velocidad", "Tamaño")
+	for _, r := range results {
+		if r.Error != "" {
+			fmt.Printf("%-10s %6d  error: %s\n", r.Preset, r.Threads, r.Error)
+			continue
+		}
+		fmt.Printf("%-10s %6d %8.2f s %9.2fx %7.2f MB\n", r.Preset, r.Threads, r.Seconds, r.Speed, float64(r.OutputBytes)/(1024*1024))
 	}
 
-	// Verificar si tiene audio
-	cmdAudio := exec.Command(
-		"ffprobe", "-v", "error", "-select_streams", "a",
-		"-show_entries", "stream=codec_type", "-of", "csv=p=0",
-		videoPath,
-	)
-
-	audioOutput, _ := cmdAudio.Output()
-	hasAudio := len(strings.TrimSpace(string(audioOutput))) > 0
-
-	return &VideoInfo{
-		Width:    width,
-		Height:   height,
-		Duration: duration,
-		HasAudio: hasAudio,
-	}, nil
+	best, ok := pyxelart.RecommendBench(results)
+	if !ok {
+		fmt.Println("\nNinguna combinación terminó bien")
+		return
+	}
+	fmt.Printf("\nRecomendado: -preset %s -threads %d (%.2fx, %.2f MB)\n", best.Preset, best.Threads, best.Speed, float64(best.OutputBytes)/(1024*1024))
+	fmt.Println("Es la combinación más rápida cuya salida no supera en más de un 5% a la más chica")
 }
 
-// convertToWebm convierte un video a formato WebM
-func convertToWebm(inputVideo, outputPath string, opts ConversionOptions) error {
-	// Verificar si el video existe
-	if _, err := os.Stat(inputVideo); os.IsNotExist(err) {
-		return fmt.Errorf("el archivo '%s' no existe", inputVideo)
+// openProgressJSON abre el destino de -json-progress: "stderr" o un archivo (o
+// named pipe) al que se agregan los eventos
+func openProgressJSON(target string) (io.Writer, error) {
+	if target == "stderr" {
+		return os.Stderr, nil
 	}
+	return os.OpenFile(target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+}
 
-	// Obtener información del video
-	videoInfo, err := getVideoInfo(inputVideo)
-	if err != nil {
-		return fmt.Errorf("error al obtener información del video: %w", err)
+// printEstimate muestra la previsión de tamaño de cada video y el total del lote
+func printEstimate(estimate *pyxelart.SizeEstimate) {
+	if len(estimate.Files) == 0 {
+		fmt.Println("No se encontraron videos para estimar")
+		return
 	}
-
-	// Determinar ruta de salida
-	if outputPath == "" {
-		dir := filepath.Dir(inputVideo)
-		filename := snakeCaseFilename(filepath.Base(inputVideo)) + ".webm"
-		outputPath = filepath.Join(dir, filename)
+	for _, file := range estimate.Files {
+		if file.Error != "" {
+			fmt.Printf("✗ %s: %s\n", file.InputPath, file.Error)
+			continue
+		}
+		fmt.Printf("%s: %.1f s a %d+%d kbps ≈ %.2f MB\n", file.InputPath, file.Duration,
+			file.VideoKbps, file.AudioKbps, float64(file.Bytes)/(1024*1024))
+	}
+	fmt.Printf("\nTotal estimado: %.2f MB para %d videos", float64(estimate.TotalBytes)/(1024*1024), len(estimate.Files))
+	if estimate.Found > len(estimate.Files) {
+		fmt.Printf(" de %d encontrados", estimate.Found)
 	}
+	if estimate.TotalInputBytes > 0 {
+		fmt.Printf(" (los originales ocupan %.2f MB)", float64(estimate.TotalInputBytes)/(1024*1024))
+	}
+	fmt.Println()
+	fmt.Println("Es una aproximación: el tamaño real depende del contenido de cada video")
+}
 
-	// Preparar directorio de salida
-	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
-		return fmt.Errorf("error al crear directorio de salida: %w", err)
+// printVideoInfo muestra un reporte legible con los datos de un video
+func printVideoInfo(path string, info *pyxelart.VideoInfo) {
+	audio := "no"
+	if info.HasAudio {
+		audio = "sí"
 	}
 
-	// Convertir calidad (0-100) a bitrate aproximado (kbps)
-	var bitrate int
-	if opts.Quality < 30 {
-		// Calidades muy bajas: 100-500 kbps
-		bitrate = 100 + (400*opts.Quality)/30
-	} else if opts.Quality < 70 {
-		// Calidades medias: 500-2000 kbps
-		bitrate = 500 + (1500*(opts.Quality-30))/40
+	fmt.Printf("Archivo:     %s\n", path)
+	fmt.Printf("Tamaño:      %.2f MB\n", float64(info.Size)/(1024*1024))
+	if info.Rotation != 0 {
+		fmt.Printf("Dimensiones: %dx%d (rotación %d°)\n", info.Width, info.Height, info.Rotation)
 	} else {
-		// Calidades altas: 2000-6000 kbps
-		bitrate = 2000 + (4000*(opts.Quality-70))/30
+		fmt.Printf("Dimensiones: %dx%d\n", info.Width, info.Height)
 	}
-
-	// Construir comando ffmpeg
-	args := []string{"-y"}
-
-	// Reducir verbosidad si no está en modo verbose
-	if !opts.Verbose {
-		args = append(args, "-v", "warning")
+	fmt.Printf("Duración:    %.2f segundos\n", info.Duration)
+	if info.HasAlpha {
+		fmt.Printf("Códec:       %s (%s, con alfa)\n", info.Codec, info.PixFmt)
+	} else {
+		fmt.Printf("Códec:       %s (%s)\n", info.Codec, info.PixFmt)
 	}
-
-	args = append(args, "-i", inputVideo)
-
-	// Aplicar filtros si es necesario
-	var filters []string
-
-	// Filtro de recorte
-	if opts.Crop != "" {
-		parts := strings.Split(opts.Crop, ":")
-		if len(parts) == 4 {
-			x, y, w, h := parts[0], parts[1], parts[2], parts[3]
-			filters = append(filters, fmt.Sprintf("crop=%s:%s:%s:%s", w, h, x, y))
-		}
+	fmt.Printf("FPS:         %.2f\n", info.FPS)
+	if info.Interlaced() {
+		fmt.Printf("Entrelazado: sí (%s)\n", info.FieldOrder)
 	}
-
-	// Filtro de redimensionamiento
-	if opts.Resize != "" {
-		parts := strings.Split(opts.Resize, "x")
-		if len(parts) == 2 {
-			width, height := parts[0], parts[1]
-			filters = append(filters, fmt.Sprintf("scale=%s:%s:force_original_aspect_ratio=decrease", width, height))
+	if info.HDR() {
+		fmt.Printf("HDR:         sí (%s, %s)\n", info.ColorTransfer, info.ColorPrimaries)
+	}
+	fmt.Printf("Bitrate:     %d kbps\n", info.Bitrate/1000)
+	fmt.Printf("Audio:       %s\n", audio)
+	if info.SubtitleStreams > 0 {
+		fmt.Printf("Subtítulos:  %d\n", info.SubtitleStreams)
+	}
+	if len(info.Chapters) > 0 {
+		fmt.Println("Capítulos:")
+		for i, chapter := range info.Chapters {
+			fmt.Printf("  %2d. %8.2f - %8.2f  %s\n", i+1, chapter.Start, chapter.End, chapter.Title)
 		}
 	}
 
-	// Agregar filtros al comando
-	if len(filters) > 0 {
-		args = append(args, "-vf", strings.Join(filters, ","))
+	if len(info.Tags) > 0 {
+		keys := make([]string, 0, len(info.Tags))
+		for key := range info.Tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Println("Metadatos:")
+		for _, key := range keys {
+			fmt.Printf("  %s: %s\n", key, info.Tags[key])
+		}
 	}
+}
 
-	// Configuración de codificación
-	args = append(args,
-		"-c:v", "libvpx-vp9",
-		"-b:v", fmt.Sprintf("%dk", bitrate),
-		"-deadline", "good",
-		"-cpu-used", "4",
-		"-pix_fmt", "yuv420p",
-	)
+// printJSON escribe un valor como JSON en la salida estándar
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
 
-	// Configurar número de hilos
-	if opts.Threads > 0 {
-		args = append(args, "-threads", strconv.Itoa(opts.Threads))
+// isTerminal indica si el archivo es una terminal interactiva
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
 	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
 
-	// Configuración de audio
-	if videoInfo.HasAudio {
-		args = append(args,
-			"-c:a", "libopus",
-			"-b:a", "96k",
-		)
+// parseSize convierte tamaños legibles como "10MB", "1.5G" o "500k" a bytes.
+// Usa múltiplos de 1024 y un número sin unidad se interpreta en bytes
+func parseSize(original string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(original))
+	if value == "" {
+		return 0, nil
 	}
 
-	// Archivo de salida
-	args = append(args, outputPath)
-
-	// Mensaje inicial
-	fmt.Printf("Convirtiendo: %s\n", filepath.Base(inputVideo))
-	if opts.Verbose {
-		fmt.Printf("Comando: ffmpeg %s\n", strings.Join(args, " "))
+	units := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+		{"B", 1},
 	}
 
-	// Ejecutar comando
-	cmd := exec.Command("ffmpeg", args...)
-	if opts.Verbose {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+	multiplier := 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			multiplier = unit.multiplier
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			break
+		}
 	}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("error durante la conversión: %w", err)
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("tamaño inválido: '%s' (ejemplos: 500KB, 10MB, 1.5GB)", original)
 	}
+	return int64(number * multiplier), nil
+}
 
-	// Verificar tamaños para comparación
-	inputInfo, err := os.Stat(inputVideo)
-	if err != nil {
-		return fmt.Errorf("error al obtener tamaño del archivo original: %w", err)
+// splitList separa una lista de valores separados por comas, descartando los vacíos
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
+}
 
-	outputInfo, err := os.Stat(outputPath)
-	if err != nil {
-		return fmt.Errorf("error al obtener tamaño del archivo convertido: %w", err)
+// splitArgs separa una cadena en argumentos como lo haría una shell simple:
+// los espacios separan, las comillas simples y dobles agrupan y la barra
+// invertida escapa el carácter siguiente (salvo dentro de comillas simples)
+func splitArgs(value string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, r := range value {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
 	}
 
-	inputSize := float64(inputInfo.Size()) / (1024 * 1024) // MB
-	outputSize := float64(outputInfo.Size()) / (1024 * 1024) // MB
-	ratio := (outputSize / inputSize) * 100
+	if quote != 0 {
+		return nil, fmt.Errorf("comillas sin cerrar en '%s'", value)
+	}
+	if escaped {
+		return nil, fmt.Errorf("barra invertida al final de '%s'", value)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
 
-	// Mostrar información de tamaño
-	fmt.Printf("✓ %s - %.2f MB (%.1f%% del original)\n", filepath.Base(outputPath), outputSize, ratio)
+// maxExitCode es el mayor código de salida usado para informar fallas; los
+// valores desde 126 tienen un significado especial para la shell
+const maxExitCode = 125
 
-	return nil
+// batchExitCode devuelve el código de salida de un lote: 0 si no hubo fallas, el
+// código fijo indicado o, si es 0, la cantidad de errores (como máximo maxExitCode)
+func batchExitCode(failures, fixed int) int {
+	if failures == 0 {
+		return 0
+	}
+	if fixed > 0 {
+		return fixed
+	}
+	return min(failures, maxExitCode)
 }
 
-// processDirectory procesa todos los videos en un directorio
-func processDirectory(inputDir, outputDir string, opts ConversionOptions, recursive bool, maxWorkers int) (*ConversionStats, error) {
-	// Verificar directorio de entrada
-	if _, err := os.Stat(inputDir); os.IsNotExist(err) {
-		return nil, fmt.Errorf("el directorio '%s' no existe", inputDir)
-	}
+// interruptContext devuelve un contexto que se cancela con Ctrl-C o SIGTERM. Si
+// drain no es nil, la primera señal solo lo cierra para que el lote termine los
+// archivos en curso, y recién la segunda cancela el contexto y corta ffmpeg.
+// Desde una terminal Ctrl-C también llega a los ffmpeg en ejecución; para drenar
+// sin afectarlos se puede enviar la señal solo a este proceso (kill -INT <pid>)
+func interruptContext(drain chan struct{}) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		if drain != nil {
+			select {
+			case <-signals:
+				infof("\nInterrupción recibida: se terminan los archivos en curso (repetir para cortarlos)\n")
+				close(drain)
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
-	// Determinar directorio de salida
-	if outputDir == "" {
-		outputDir = filepath.Join(inputDir, "webm")
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
 	}
+}
 
-	// Crear directorio de salida si no existe
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return nil, fmt.Errorf("error al crear directorio de salida: %w", err)
-	}
+// envPrefix antecede al nombre de cada opción en las variables de entorno
+// (-quality -> PYXELART_QUALITY, -two-pass -> PYXELART_TWO_PASS)
+const envPrefix = "PYXELART_"
 
-	// Extensiones de video soportadas
-	videoExtensions := map[string]bool{
-		".mp4":  true,
-		".avi":  true,
-		".mov":  true,
-		".mkv":  true,
-		".flv":  true,
-		".wmv":  true,
-		".webm": true,
-	}
+// optionPrecedence describe cómo se combinan las distintas fuentes de opciones
+const optionPrecedence = "línea de comandos > variables de entorno > archivo de configuración > valores por defecto"
 
-	// Encontrar todos los videos
-	var videos []string
+// setFlags devuelve las opciones de fs que ya recibieron un valor
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
 
-	if recursive {
-		// Buscar en subdirectorios
-		err := filepath.Walk(inputDir, func(path string, info fs.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			if !info.IsDir() && videoExtensions[strings.ToLower(filepath.Ext(path))] {
-				videos = append(videos, path)
-			}
-			return nil
-		})
-		if err != nil {
-			return nil, fmt.Errorf("error al buscar videos: %w", err)
-		}
-	} else {
-		// Buscar solo en el directorio principal
-		entries, err := os.ReadDir(inputDir)
-		if err != nil {
-			return nil, fmt.Errorf("error al leer directorio: %w", err)
-		}
+// applyEnv toma de las variables PYXELART_* el valor de las opciones que no se
+// indicaron en la línea de comandos
+func applyEnv(fs *flag.FlagSet) error {
+	explicit := setFlags(fs)
 
-		for _, entry := range entries {
-			if !entry.IsDir() && videoExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
-				videos = append(videos, filepath.Join(inputDir, entry.Name()))
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || explicit[f.Name] {
+			return
+		}
+		name := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value := os.Getenv(name); value != "" {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("valor inválido en %s: %w", name, setErr)
 			}
 		}
-	}
+	})
+	return err
+}
 
-	if len(videos) == 0 {
-		fmt.Printf("No se encontraron videos en '%s'\n", inputDir)
-		return &ConversionStats{}, nil
+// flagUsage muestra la ayuda de fs junto con las fuentes alternativas de opciones
+func flagUsage(fs *flag.FlagSet) func() {
+	return func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Uso de %s:\n", fs.Name())
+		fs.PrintDefaults()
+		fmt.Fprintf(out, "\nCada opción también se puede definir con una variable de entorno %s<OPCIÓN>\n", envPrefix)
+		fmt.Fprintf(out, "(ej: %sQUALITY=40, %sTWO_PASS=true) o en el archivo de configuración.\n", envPrefix, envPrefix)
+		fmt.Fprintf(out, "Prioridad: %s\n", optionPrecedence)
 	}
+}
 
-	fmt.Printf("Encontrados %d videos para procesar\n", len(videos))
-
-	stats := &ConversionStats{
-		Total: len(videos),
-	}
+// defaultConfigFiles son los archivos de configuración que se buscan en el
+// directorio personal si no se indica -config
+var defaultConfigFiles = []string{".pyxelart.yaml", ".pyxelart.yml", ".pyxelart.json"}
 
-	// Preparar canal de trabajo
-	type workItem struct {
-		videoPath string
-		index     int
+// loadConfig lee un archivo de configuración cuyas claves son nombres de opciones
+// de la línea de comandos. Admite un objeto JSON o pares "clave: valor" al
+// estilo YAML (sin anidar), con comentarios que empiezan con #
+func loadConfig(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la configuración: %w", err)
 	}
 
-	workChan := make(chan workItem, len(videos))
-	for i, video := range videos {
-		workChan <- workItem{video, i}
+	config := make(map[string]string)
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("{")) {
+		// UseNumber conserva los números tal cual ("1000000" y no "1e+06")
+		var values map[string]any
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.UseNumber()
+		if err := decoder.Decode(&values); err != nil {
+			return nil, fmt.Errorf("configuración JSON inválida en '%s': %w", path, err)
+		}
+		for key, value := range values {
+			config[key] = fmt.Sprint(value)
+		}
+		return config, nil
 	}
-	close(workChan)
 
-	var wg sync.WaitGroup
-	numWorkers := maxWorkers
-	if numWorkers <= 0 {
-		numWorkers = 1
-	}
-	if numWorkers > len(videos) {
-		numWorkers = len(videos)
+	for lineNum, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimRight(line, " \t\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found || key != strings.TrimSpace(key) || strings.HasPrefix(key, "-") {
+			return nil, fmt.Errorf("línea %d de '%s': solo se admiten pares \"clave: valor\" sin anidar", lineNum+1, path)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		config[key] = value
 	}
+	return config, nil
+}
 
-	// Función para procesar un video
-	processVideo := func(item workItem) bool {
-		videoPath := item.videoPath
-		relPath, err := filepath.Rel(inputDir, videoPath)
+// applyConfig usa el archivo de configuración como valores por defecto de las
+// opciones de fs: las que ya tienen valor (línea de comandos o entorno) tienen prioridad.
+// Sin path se busca uno de defaultConfigFiles en el directorio personal. Las
+// claves que pertenecen a otro subcomando se ignoran
+func applyConfig(fs *flag.FlagSet, path string, others ...*flag.FlagSet) error {
+	if path == "" {
+		home, err := os.UserHomeDir()
 		if err != nil {
-			relPath = filepath.Base(videoPath)
+			return nil
 		}
-
-		outputSubdir := filepath.Dir(relPath)
-		fullOutputDir := filepath.Join(outputDir, outputSubdir)
-
-		// Asegurar que existe el subdirectorio de salida
-		if err := os.MkdirAll(fullOutputDir, 0755); err != nil {
-			fmt.Printf("Error al crear subdirectorio: %s\n", err)
-			return false
+		for _, name := range defaultConfigFiles {
+			if _, err := os.Stat(filepath.Join(home, name)); err == nil {
+				path = filepath.Join(home, name)
+				break
+			}
+		}
+		if path == "" {
+			return nil
 		}
+	}
 
-		outputFile := filepath.Join(
-			fullOutputDir,
-			snakeCaseFilename(filepath.Base(videoPath))+".webm",
-		)
+	config, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
 
-		// Comprobar si el archivo ya existe y es más reciente que el original
-		if info, err := os.Stat(outputFile); err == nil {
-			inputInfo, err := os.Stat(videoPath)
-			if err == nil {
-				if info.ModTime().After(inputInfo.ModTime()) {
-					fmt.Printf("Omitiendo %s - ya procesado\n", filepath.Base(videoPath))
-					return true
-				}
+	explicit := setFlags(fs)
+
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if fs.Lookup(key) == nil {
+			known := false
+			for _, other := range others {
+				known = known || other.Lookup(key) != nil
+			}
+			if !known {
+				return fmt.Errorf("opción desconocida '%s' en la configuración '%s'", key, path)
 			}
+			continue
+		}
+		if explicit[key] || key == "config" {
+			continue
+		}
+		if err := fs.Set(key, config[key]); err != nil {
+			return fmt.Errorf("valor inválido para '%s' en la configuración '%s': %w", key, path, err)
 		}
+	}
+	return nil
+}
 
-		// Convertir video
-		err = convertToWebm(videoPath, outputFile, opts)
-		if err != nil {
-			fmt.Printf("Error al convertir %s: %s\n", filepath.Base(videoPath), err)
-			return false
+// writeBatchLog agrega al archivo de log un reporte con el resultado de cada
+// archivo del lote y un resumen final
+func writeBatchLog(logPath, source string, stats *pyxelart.ConversionStats) error {
+	file, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error al abrir el archivo de log: %w", err)
+	}
+	defer file.Close()
+
+	const timeFormat = "2006-01-02 15:04:05"
+	w := bufio.NewWriter(file)
+
+	fmt.Fprintf(w, "=== Conversión por lotes %s ===\n", time.Now().Format(timeFormat))
+	fmt.Fprintf(w, "Origen: %s\n", source)
+
+	for _, result := range stats.Results {
+		timestamp := result.FinishedAt.Format(timeFormat)
+		switch {
+		case !result.Success:
+			fmt.Fprintf(w, "[%s] ERROR    %s: %s\n", timestamp, result.InputPath, result.Error)
+		case result.SkippedByDuration:
+			fmt.Fprintf(w, "[%s] OMITIDO  %s: %s\n", timestamp, result.InputPath, result.SkipReason)
+		case result.Skipped:
+			fmt.Fprintf(w, "[%s] OMITIDO  %s -> %s\n", timestamp, result.InputPath, result.OutputPath)
+		default:
+			fmt.Fprintf(w, "[%s] OK       %s -> %s | %.2f MB -> %.2f MB (%.1f%%)\n",
+				timestamp, result.InputPath, result.OutputPath,
+				float64(result.InputSizeBytes)/(1024*1024), float64(result.OutputSizeBytes)/(1024*1024),
+				result.Ratio)
 		}
+	}
 
-		return true
+	fmt.Fprintf(w, "Resumen: %d total, %d exitosas, %d errores, %.2f MB ahorrados\n\n",
+		stats.Total, stats.Exito, stats.Error, float64(stats.SavedBytes())/(1024*1024))
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error al escribir el archivo de log: %w", err)
 	}
+	return nil
+}
 
-	// Iniciar trabajadores
-	if numWorkers <= 1 {
-		// Modo secuencial
-		for item := range workChan {
-			success := processVideo(item)
-			if success {
-				stats.Exito++
-			} else {
-				stats.Error++
-			}
-		}
-	} else {
-		// Modo paralelo
-		wg.Add(numWorkers)
-		for i := 0; i < numWorkers; i++ {
-			go func() {
-				defer wg.Done()
-				for item := range workChan {
-					success := processVideo(item)
-					if success {
-						stats.incrementarExito()
-					} else {
-						stats.incrementarError()
-					}
-				}
-			}()
+// writeBatchCSV escribe en csvPath una fila por archivo del lote, para revisar
+// el resultado en una planilla de cálculo. El archivo se reemplaza en cada lote
+func writeBatchCSV(csvPath string, stats *pyxelart.ConversionStats) error {
+	file, err := os.Create(csvPath)
+	if err != nil {
+		return fmt.Errorf("error al crear el reporte CSV: %w", err)
+	}
+	defer file.Close()
+
+	// encoding/csv pone entre comillas los campos con comas, comillas o saltos de línea
+	w := csv.NewWriter(file)
+	w.Write([]string{"input", "output", "input_mb", "output_mb", "ratio", "seconds", "status", "error"})
+	for _, result := range stats.Results {
+		status := "ok"
+		switch {
+		case !result.Success:
+			status = "error"
+		case result.Skipped:
+			status = "skipped"
 		}
-		wg.Wait()
+		w.Write([]string{
+			result.InputPath,
+			result.OutputPath,
+			strconv.FormatFloat(float64(result.InputSizeBytes)/(1024*1024), 'f', 2, 64),
+			strconv.FormatFloat(float64(result.OutputSizeBytes)/(1024*1024), 'f', 2, 64),
+			strconv.FormatFloat(result.Ratio, 'f', 1, 64),
+			strconv.FormatFloat(result.Elapsed.Seconds(), 'f', 2, 64),
+			status,
+			cmp.Or(result.Error, result.SkipReason),
+		})
 	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error al escribir el reporte CSV: %w", err)
+	}
+	return file.Close()
+}
 
-	// Mostrar estadísticas
-	fmt.Printf("\nProceso completado:\n")
-	fmt.Printf("- Total procesados: %d\n", stats.Total)
-	fmt.Printf("- Conversiones exitosas: %d\n", stats.Exito)
-	fmt.Printf("- Errores: %d\n", stats.Error)
-
-	return stats, nil
+// printBanner muestra el encabezado del programa
+func printBanner() {
+	infof("╔═══════════════════════════════════════╗\n")
+	infof("║          WebM Converter v1.0          ║\n")
+	infof("╚═══════════════════════════════════════╝\n")
 }
 
 func main() {
 	// Definir comandos
 	fileCmd := flag.NewFlagSet("file", flag.ExitOnError)
 	dirCmd := flag.NewFlagSet("dir", flag.ExitOnError)
-
-	// Variables comunes
-	var quality int
-	var resize, crop string
-	var verbose bool
+	infoCmd := flag.NewFlagSet("info", flag.ExitOnError)
+	benchCmd := flag.NewFlagSet("bench", flag.ExitOnError)
+	fileCmd.Usage = flagUsage(fileCmd)
+	dirCmd.Usage = flagUsage(dirCmd)
 
 	// Variables para comando 'file'
-	fileInput := fileCmd.String("input", "", "Archivo de video de entrada")
-	fileOutput := fileCmd.String("output", "", "Ruta de salida (opcional)")
-	fileCmd.IntVar(&quality, "quality", 30, "Calidad del video (0-100)")
-	fileCmd.StringVar(&resize, "resize", "", "Redimensionar video (formato: widthxheight)")
-	fileCmd.StringVar(&crop, "crop", "", "Recortar video (formato: x:y:width:height)")
-	fileCmd.BoolVar(&verbose, "verbose", false, "Mostrar información detallada")
-	fileCmd.BoolVar(&verbose, "v", false, "Mostrar información detallada (forma corta)")
+	fileInput := fileCmd.String("input", "", "Archivo de video de entrada (\"-\" lee de stdin)")
+	fileOutput := fileCmd.String("output", "", "Ruta de salida (opcional; \"-\" escribe en stdout; con -split-chapters, el directorio de salida)")
+	splitChapters := fileCmd.Bool("split-chapters", false, "Convertir cada capítulo del original en un archivo propio")
+	concat := fileCmd.Bool("concat", false, "Unir en un solo video -input y los archivos indicados a continuación, en orden")
+	fileFlags := registerConversionFlags(fileCmd)
 
 	// Variables para comando 'dir'
 	dirInput := dirCmd.String("input", "", "Directorio de entrada")
 	dirOutput := dirCmd.String("output", "", "Directorio de salida (opcional)")
-	dirCmd.IntVar(&quality, "quality", 30, "Calidad del video (0-100)")
-	dirCmd.StringVar(&resize, "resize", "", "Redimensionar video (formato: widthxheight)")
-	dirCmd.StringVar(&crop, "crop", "", "Recortar video (formato: x:y:width:height)")
+	dirFlags := registerConversionFlags(dirCmd)
+	dirCmd.DurationVar(&dirFlags.timeout, "file-timeout", 0, "Igual que -timeout: al vencer se corta ffmpeg, se borra la salida parcial y el lote sigue")
 	recursive := dirCmd.Bool("recursive", false, "Buscar videos en subdirectorios")
 	workers := dirCmd.Int("workers", 1, "Número máximo de trabajos en paralelo")
-	dirCmd.BoolVar(&verbose, "verbose", false, "Mostrar información detallada")
-	dirCmd.BoolVar(&verbose, "v", false, "Mostrar información detallada (forma corta)")
+	flatten := dirCmd.Bool("flatten", false, "Dejar todas las salidas en el directorio de salida, sin replicar subdirectorios")
+	onCollision := dirCmd.String("on-collision", "suffix", "Si dos videos generan la misma salida: suffix (agrega _2, _3, ...) o error")
+	limit := dirCmd.Int("limit", 0, "Convertir solo los primeros N videos encontrados (después de -sort); útil para probar la configuración")
+	shuffle := dirCmd.Bool("shuffle", false, "Convertir los videos en orden aleatorio (con -limit, para probar con una muestra)")
+	seed := dirCmd.Int64("seed", 0, "Semilla de -shuffle para repetir el mismo orden (0 = al azar)")
+	sortOrder := dirCmd.String("sort", "", "Orden de conversión: name, size, size-desc (los más grandes primero) o mtime (los más viejos primero)")
+	skipWebm := dirCmd.Bool("skip-webm", true, "Excluir los archivos .webm de entrada (use -skip-webm=false para incluirlos)")
+	extensions := dirCmd.String("extensions", "", "Extensiones a procesar, reemplazan a las por defecto (ej: mp4,mov,m4v)")
+	addExtensions := dirCmd.String("add-extensions", "", "Extensiones adicionales a procesar (ej: m4v,mpg)")
+	include := dirCmd.String("include", "", "Procesar solo archivos que coincidan con estos patrones glob (separados por comas)")
+	exclude := dirCmd.String("exclude", "", "Ignorar archivos que coincidan con estos patrones glob (separados por comas)")
+	minSize := dirCmd.String("min-size", "", "Ignorar archivos más chicos que este tamaño (ej: 10MB)")
+	maxSize := dirCmd.String("max-size", "", "Ignorar archivos más grandes que este tamaño (ej: 2GB)")
+	listPath := dirCmd.String("list", "", "Archivo con las rutas a convertir, una por línea (\"-\" lee de la entrada estándar); reemplaza a -input")
+	failFast := dirCmd.Bool("fail-fast", false, "Cancelar todo el lote ante el primer error")
+	watch := dirCmd.Bool("watch", false, "Después de la primera pasada, seguir esperando videos nuevos y convertirlos (Ctrl-C para terminar)")
+	watchInterval := dirCmd.Duration("watch-interval", pyxelart.DefaultWatchInterval, "Cada cuánto revisar el directorio con -watch")
+	resumePath := dirCmd.String("resume", "", "Archivo de estado para retomar un lote: registra los videos convertidos y los omite en la próxima ejecución")
+	exitCode := dirCmd.Int("exit-code", 0, "Código de salida si alguna conversión falla (0 = cantidad de errores, hasta 125)")
+	logPath := dirCmd.String("log", "", "Agregar un reporte del lote a este archivo de log")
+	csvPath := dirCmd.String("csv", "", "Escribir un reporte CSV del lote (una fila por archivo) en esta ruta")
+	estimate := dirCmd.Bool("estimate", false, "Estimar el tamaño total de las salidas sin convertir (según la duración de cada video y el bitrate)")
+
+	// Variables para comando 'info'
+	infoInput := infoCmd.String("input", "", "Archivo de video a analizar")
+	infoProbe := infoCmd.String("ffprobe-path", envOrDefault("FFPROBE_BIN", "ffprobe"), "Ruta o nombre del binario de ffprobe (env: FFPROBE_BIN)")
+	infoJSON := infoCmd.Bool("json", false, "Emitir la información en formato JSON")
+
+	// Variables para comando 'bench'
+	benchInput := benchCmd.String("input", "", "Archivo de video a usar en la prueba")
+	benchSample := benchCmd.Float64("sample", pyxelart.DefaultBenchSample, "Segundos del fragmento que codifica cada combinación")
+	benchPresets := benchCmd.String("presets", "fast,balanced,slow", "Presets a comparar, separados por comas")
+	benchThreads := benchCmd.String("threads", "", "Cantidades de hilos a comparar, separadas por comas (vacío = 1, la mitad de los núcleos y todos)")
+	benchCodec := benchCmd.String("codec", "vp9", "Códec de video para WebM (vp8, vp9, av1)")
+	benchFormat := benchCmd.String("format", "webm", "Formato de salida: webm o mp4")
+	benchQuality := benchCmd.Int("quality", 30, "Calidad del video (0-100)")
+	benchCRF := benchCmd.Int("crf", -1, "Calidad constante (CRF); -1 usa -quality")
+	benchResize := benchCmd.String("resize", "", "Redimensionar (ej: 1280x720)")
+	benchFFmpeg := benchCmd.String("ffmpeg-path", envOrDefault("FFMPEG_BIN", "ffmpeg"), "Ruta o nombre del binario de ffmpeg (env: FFMPEG_BIN)")
+	benchProbe := benchCmd.String("ffprobe-path", envOrDefault("FFPROBE_BIN", "ffprobe"), "Ruta o nombre del binario de ffprobe (env: FFPROBE_BIN)")
+	benchJSON := benchCmd.Bool("json", false, "Emitir los resultados en formato JSON")
 
 	// Verificar si hay argumentos
 	if len(os.Args) < 2 {
-		fmt.Println("Se requiere un subcomando: 'file' o 'dir'")
+		fmt.Println("Se requiere un subcomando: 'file', 'dir', 'info' o 'bench'")
 		fmt.Println("Uso:")
 		fmt.Println("  webm_converter file -input <archivo> [opciones]")
 		fmt.Println("  webm_converter dir -input <directorio> [opciones]")
+		fmt.Println("  webm_converter dir -list <archivo|-> [opciones]")
+		fmt.Println("  webm_converter info -input <archivo> [-json]")
+		fmt.Println("  webm_converter bench -input <archivo> [opciones]")
 		os.Exit(1)
 	}
 
-	// Mostrar banner
-	fmt.Println("╔═══════════════════════════════════════╗")
-	fmt.Println("║          WebM Converter v1.0          ║")
-	fmt.Println("╚═══════════════════════════════════════╝")
+	// Cancelar las conversiones en curso con Ctrl-C o SIGTERM; en un lote la
+	// primera señal deja terminar los archivos en curso y la segunda los corta
+	var drain chan struct{}
+	if os.Args[1] == "dir" {
+		drain = make(chan struct{})
+	}
+	ctx, stop := interruptContext(drain)
+	defer stop()
 
 	// Analizar argumentos según el subcomando
 	switch os.Args[1] {
 	case "file":
 		fileCmd.Parse(os.Args[2:])
-		if *fileInput == "" {
-			fmt.Println("Error: Se requiere especificar un archivo de entrada")
+		// Con -output - el video ocupa stdout y los mensajes pasan a stderr
+		if *fileOutput == pyxelart.StdioPath {
+			logOutput = os.Stderr
+			pyxelart.SetLogOutput(os.Stderr)
+		}
+		if err := applyEnv(fileCmd); err != nil {
+			errorf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		if err := applyConfig(fileCmd, fileFlags.configPath, dirCmd); err != nil {
+			errorf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		if err := pyxelart.ConfigureLogging(fileFlags.quiet, fileFlags.verbose); err != nil {
+			errorf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		if !fileFlags.jsonOutput {
+			printBanner()
+		}
+		// Con -concat los archivos a unir pueden seguir a las opciones
+		inputs := fileCmd.Args()
+		if *fileInput != "" {
+			inputs = append([]string{*fileInput}, inputs...)
+		}
+		if len(inputs) == 0 {
+			errorf("Error: Se requiere especificar un archivo de entrada\n")
 			fileCmd.PrintDefaults()
 			os.Exit(1)
 		}
+		if !*concat && len(inputs) > 1 {
+			errorf("Error: argumentos de más: %s (para unir varios archivos use -concat)\n", strings.Join(inputs[1:], " "))
+			os.Exit(1)
+		}
+		*fileInput = inputs[0]
+
+		// Configurar opciones
+		opts, err := fileFlags.options()
+		if err != nil {
+			errorf("Error: %s\n", err)
+			os.Exit(1)
+		}
 
 		// Validar argumentos
-		if quality < 0 || quality > 100 {
-			fmt.Println("Error: La calidad debe estar entre 0 y 100")
+		if err := pyxelart.ValidateOptions(opts); err != nil {
+			errorf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		if fileFlags.jsonProgress != "" {
+			if opts.ProgressJSON, err = openProgressJSON(fileFlags.jsonProgress); err != nil {
+				errorf("Error: -json-progress: %s\n", err)
+				os.Exit(1)
+			}
+		}
+		// Cada capítulo ya es un segmento: no se puede recortar otro encima, y el
+		// original se necesita hasta convertir el último
+		if *splitChapters && (fileFlags.startTime != "" || fileFlags.endTime != "" || fileFlags.sample > 0 || fileFlags.deleteSource) {
+			errorf("Error: -split-chapters no se puede usar con -start, -end, -sample ni -delete-source\n")
+			os.Exit(1)
+		}
+		if *concat && (len(inputs) < 2 || *splitChapters || fileFlags.deleteSource) {
+			errorf("Error: -concat requiere al menos dos archivos y no se puede usar con -split-chapters ni -delete-source\n")
+			os.Exit(1)
+		}
+		if slices.Contains(inputs, pyxelart.StdioPath) && (*fileOutput == "" || *concat || *splitChapters || fileFlags.deleteSource || fileFlags.dryRun) {
+			errorf("Error: -input - requiere -output y no se puede usar con -concat, -split-chapters, -delete-source ni -dry-run\n")
+			os.Exit(1)
+		}
+		if *fileOutput == pyxelart.StdioPath && (fileFlags.jsonOutput || fileFlags.thumbnail || *splitChapters) {
+			errorf("Error: -output - no se puede usar con -json, -thumbnail ni -split-chapters\n")
 			os.Exit(1)
 		}
 
-		// Configurar opciones
-		opts := ConversionOptions{
-			Quality: quality,
-			Resize:  resize,
-			Crop:    crop,
-			Verbose: verbose,
+		// Eliminar el original es irreversible: se confirma salvo con -yes
+		if fileFlags.deleteSource && !fileFlags.assumeYes && !fileFlags.dryRun {
+			if fileFlags.jsonOutput || *fileOutput == pyxelart.StdioPath {
+				errorf("Error: -delete-source con -json u -output - requiere -yes\n")
+				os.Exit(1)
+			}
+			if !confirm("Se eliminará el original después de convertirlo. ¿Continuar?") {
+				errorf("Cancelado\n")
+				os.Exit(1)
+			}
+		}
+
+		// Verificar dependencias
+		pyxelart.FFmpegBin, pyxelart.FFprobeBin = fileFlags.ffmpegPath, fileFlags.ffprobePath
+		if err := pyxelart.CheckDependencies(fileFlags.verbose && !fileFlags.jsonOutput); err != nil {
+			errorf("Error: %s\n", err)
+			os.Exit(1)
 		}
 
 		// Convertir archivo
+		if !fileFlags.jsonOutput {
+			if *concat {
+				infof("Uniendo %d archivos\n", len(inputs))
+			} else if *fileInput == pyxelart.StdioPath {
+				infof("Convirtiendo: (stdin)\n")
+			} else {
+				infof("Convirtiendo: %s\n", filepath.Base(*fileInput))
+			}
+		}
 		start := time.Now()
-		err := convertToWebm(*fileInput, *fileOutput, opts)
+		if *splitChapters {
+			results, err := pyxelart.ConvertChapters(ctx, *fileInput, *fileOutput, opts)
+			if fileFlags.jsonOutput {
+				// Sin capítulos convertidos el error se informa como el de un único resultado
+				if results == nil && err != nil {
+					results = []pyxelart.ConversionResult{{InputPath: *fileInput, Error: err.Error()}}
+				}
+				printJSON(results)
+			} else if err != nil {
+				errorf("Error: %s\n", err)
+			}
+			if err != nil {
+				os.Exit(1)
+			}
+			infof("%d capítulos convertidos en %.2f segundos\n", len(results), time.Since(start).Seconds())
+			break
+		}
+		var result pyxelart.ConversionResult
+		if *concat {
+			result, err = pyxelart.ConcatVideos(ctx, inputs, *fileOutput, opts)
+		} else {
+			result, err = pyxelart.ConvertVideo(ctx, *fileInput, *fileOutput, opts)
+		}
+		if fileFlags.jsonOutput {
+			if err != nil {
+				result.Error = err.Error()
+			}
+			printJSON(result)
+			if err != nil {
+				os.Exit(1)
+			}
+			break
+		}
 		if err != nil {
-			fmt.Printf("Error: %s\n", err)
+			errorf("Error: %s\n", err)
 			os.Exit(1)
 		}
+		pyxelart.PrintResult(result, opts)
 		elapsed := time.Since(start)
-		fmt.Printf("Tiempo de conversión: %.2f segundos\n", elapsed.Seconds())
+		infof("Tiempo de conversión: %.2f segundos\n", elapsed.Seconds())
 
 	case "dir":
 		dirCmd.Parse(os.Args[2:])
-		if *dirInput == "" {
-			fmt.Println("Error: Se requiere especificar un directorio de entrada")
+		if err := applyEnv(dirCmd); err != nil {
+			errorf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		if err := applyConfig(dirCmd, dirFlags.configPath, fileCmd); err != nil {
+			errorf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		if err := pyxelart.ConfigureLogging(dirFlags.quiet, dirFlags.verbose); err != nil {
+			errorf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		if !dirFlags.jsonOutput {
+			printBanner()
+		}
+		if *dirInput == "" && *listPath == "" {
+			errorf("Error: Se requiere especificar un directorio de entrada o una lista (-list)\n")
 			dirCmd.PrintDefaults()
 			os.Exit(1)
 		}
+		if *watch && (*listPath != "" || dirFlags.dryRun) {
+			errorf("Error: -watch solo se puede usar con -input y sin -dry-run\n")
+			os.Exit(1)
+		}
+		if *estimate && (*listPath != "" || *watch) {
+			errorf("Error: -estimate solo se puede usar con -input y sin -watch\n")
+			os.Exit(1)
+		}
+
+		// Configurar opciones
+		opts, err := dirFlags.options()
+		if err != nil {
+			errorf("Error: %s\n", err)
+			os.Exit(1)
+		}
 
 		// Validar argumentos
-		if quality < 0 || quality > 100 {
-			fmt.Println("Error: La calidad debe estar entre 0 y 100")
+		if err := pyxelart.ValidateOptions(opts); err != nil {
+			errorf("Error: %s\n", err)
 			os.Exit(1)
 		}
+		if dirFlags.jsonProgress != "" {
+			if opts.ProgressJSON, err = openProgressJSON(dirFlags.jsonProgress); err != nil {
+				errorf("Error: -json-progress: %s\n", err)
+				os.Exit(1)
+			}
+		}
 
-		// Configurar opciones
-		opts := ConversionOptions{
-			Quality: quality,
-			Resize:  resize,
-			Crop:    crop,
-			Verbose: verbose,
+		// Eliminar los originales es irreversible: se confirma salvo con -yes
+		if dirFlags.deleteSource && !dirFlags.assumeYes && !dirFlags.dryRun && !*estimate {
+			if dirFlags.jsonOutput || *listPath == "-" {
+				errorf("Error: -delete-source con -json o -list - requiere -yes\n")
+				os.Exit(1)
+			}
+			if !confirm("Se eliminarán los originales después de convertirlos. ¿Continuar?") {
+				errorf("Cancelado\n")
+				os.Exit(1)
+			}
+		}
+
+		// Verificar dependencias
+		pyxelart.FFmpegBin, pyxelart.FFprobeBin = dirFlags.ffmpegPath, dirFlags.ffprobePath
+		if err := pyxelart.CheckDependencies(dirFlags.verbose && !dirFlags.jsonOutput); err != nil {
+			errorf("Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		minSizeBytes, err := parseSize(*minSize)
+		if err != nil {
+			errorf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		maxSizeBytes, err := parseSize(*maxSize)
+		if err != nil {
+			errorf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		if maxSizeBytes > 0 && minSizeBytes > maxSizeBytes {
+			errorf("Error: -min-size no puede ser mayor que -max-size\n")
+			os.Exit(1)
+		}
+
+		if *exitCode < 0 || *exitCode > maxExitCode {
+			errorf("Error: -exit-code debe estar entre 0 y %d\n", maxExitCode)
+			os.Exit(1)
+		}
+
+		if *onCollision != "suffix" && *onCollision != "error" {
+			errorf("Error: valor inválido para -on-collision: '%s' (valores válidos: suffix, error)\n", *onCollision)
+			os.Exit(1)
+		}
+		if *limit < 0 {
+			errorf("Error: -limit debe ser un número positivo\n")
+			os.Exit(1)
+		}
+		if *limit > 0 && *watch {
+			errorf("Error: -limit no se puede usar con -watch\n")
+			os.Exit(1)
+		}
+		if *shuffle && *sortOrder != "" {
+			errorf("Error: -shuffle y -sort no se pueden usar juntos\n")
+			os.Exit(1)
+		}
+		if *seed != 0 && !*shuffle {
+			errorf("Error: -seed requiere -shuffle\n")
+			os.Exit(1)
+		}
+		if *sortOrder != "" && !slices.Contains(pyxelart.SortOrders, *sortOrder) {
+			errorf("Error: valor inválido para -sort: '%s' (valores válidos: %s)\n", *sortOrder, strings.Join(pyxelart.SortOrders, ", "))
+			os.Exit(1)
 		}
 
-		// Procesar directorio
+		dirOpts := pyxelart.DirectoryOptions{
+			Recursive:  *recursive,
+			MaxWorkers: *workers,
+			SkipWebm:   *skipWebm,
+			Flatten:    *flatten,
+
+			OnCollision: *onCollision,
+			Sort:        *sortOrder,
+			Limit:       *limit,
+			Shuffle:     *shuffle,
+			Seed:        *seed,
+
+			Extensions:      splitList(*extensions),
+			ExtraExtensions: splitList(*addExtensions),
+
+			Include: splitList(*include),
+			Exclude: splitList(*exclude),
+			MinSize: minSizeBytes,
+			MaxSize: maxSizeBytes,
+
+			FailFast:      *failFast,
+			Watch:         *watch,
+			WatchInterval: *watchInterval,
+
+			Resume: *resumePath,
+			Drain:  drain,
+		}
+
+		// Solo la previsión de tamaño, sin convertir nada
+		if *estimate {
+			result, err := pyxelart.EstimateDirectory(ctx, *dirInput, *dirOutput, opts, dirOpts)
+			if err != nil {
+				errorf("Error: %s\n", err)
+				os.Exit(1)
+			}
+			if dirFlags.jsonOutput {
+				printJSON(result)
+			} else {
+				printEstimate(result)
+			}
+			return
+		}
+
+		// Procesar directorio o lista
 		start := time.Now()
-		_, err := processDirectory(*dirInput, *dirOutput, opts, *recursive, *workers)
+		source := *dirInput
+		var stats *pyxelart.ConversionStats
+		if *listPath != "" {
+			source = *listPath
+			stats, err = pyxelart.ProcessList(ctx, *listPath, *dirOutput, opts, dirOpts)
+		} else {
+			stats, err = pyxelart.ProcessDirectory(ctx, *dirInput, *dirOutput, opts, dirOpts)
+		}
 		if err != nil {
-			fmt.Printf("Error: %s\n", err)
+			errorf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		if *logPath != "" {
+			if err := writeBatchLog(*logPath, source, stats); err != nil {
+				errorf("Error: %s\n", err)
+			}
+		}
+		if *csvPath != "" {
+			if err := writeBatchCSV(*csvPath, stats); err != nil {
+				errorf("Error: %s\n", err)
+			}
+		}
+		if dirFlags.jsonOutput {
+			results := stats.Results
+			if results == nil {
+				results = []pyxelart.ConversionResult{}
+			}
+			printJSON(results)
+		} else {
+			elapsed := time.Since(start)
+			infof("Tiempo total: %.2f segundos\n", elapsed.Seconds())
+		}
+		if ctx.Err() != nil || stats.Pending > 0 {
+			os.Exit(1)
+		}
+		// Las fallas parciales también se informan, así un CI puede detectarlas
+		if code := batchExitCode(stats.Error, *exitCode); code != 0 {
+			os.Exit(code)
+		}
+
+	case "info":
+		infoCmd.Parse(os.Args[2:])
+		if *infoInput == "" {
+			errorf("Error: Se requiere especificar un archivo de entrada\n")
+			infoCmd.PrintDefaults()
+			os.Exit(1)
+		}
+		if _, err := os.Stat(*infoInput); err != nil {
+			errorf("Error: el archivo '%s' no existe\n", *infoInput)
+			os.Exit(1)
+		}
+
+		pyxelart.FFprobeBin = *infoProbe
+		info, err := pyxelart.GetVideoInfo(ctx, *infoInput)
+		if err != nil {
+			errorf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		if *infoJSON {
+			printJSON(info)
+			break
+		}
+		printVideoInfo(*infoInput, info)
+
+	case "bench":
+		benchCmd.Parse(os.Args[2:])
+		if *benchInput == "" {
+			errorf("Error: Se requiere especificar un archivo de entrada\n")
+			benchCmd.PrintDefaults()
+			os.Exit(1)
+		}
+		cases, err := benchCases(*benchPresets, *benchThreads)
+		if err != nil {
+			errorf("Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		opts := pyxelart.DefaultOptions()
+		opts.Codec = *benchCodec
+		opts.OutputFormat = *benchFormat
+		opts.Quality = *benchQuality
+		opts.CRF = *benchCRF
+		opts.Resize = *benchResize
+		opts.Sample = *benchSample
+		opts.JSON = *benchJSON
+		if opts.Sample <= 0 {
+			errorf("Error: -sample debe ser mayor que 0\n")
+			os.Exit(1)
+		}
+		if err := pyxelart.ValidateOptions(opts); err != nil {
+			errorf("Error: %s\n", err)
 			os.Exit(1)
 		}
-		elapsed := time.Since(start)
-		fmt.Printf("Tiempo total: %.2f segundos\n", elapsed.Seconds())
+
+		pyxelart.FFmpegBin, pyxelart.FFprobeBin = *benchFFmpeg, *benchProbe
+		if err := pyxelart.CheckDependencies(false); err != nil {
+			errorf("Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		results, err := pyxelart.Benchmark(ctx, *benchInput, opts, cases)
+		if err != nil {
+			errorf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		if *benchJSON {
+			printJSON(results)
+			break
+		}
+		printBenchResults(results)
 
 	default:
 		fmt.Printf("Comando desconocido: %s\n", os.Args[1])
-		fmt.Println("Use 'file' o 'dir'")
+		fmt.Println("Use 'file', 'dir', 'info' o 'bench'")
 		os.Exit(1)
 	}
-}
\ No newline at end of file
+}